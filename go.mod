@@ -13,8 +13,14 @@ replace (
 )
 
 require (
+	github.com/dustin/go-humanize v1.0.0
+	github.com/evanphx/json-patch v4.9.0+incompatible
+	github.com/hashicorp/go-multierror v1.1.1
 	github.com/hashicorp/terraform-plugin-sdk/v2 v2.6.1
+	github.com/opencontainers/runtime-spec v1.0.3-0.20200929063507-e6143ca7d51d
+	github.com/talos-systems/crypto v0.2.1-0.20210427105118-4f80b976b640
 	github.com/talos-systems/talos v0.10.0-alpha.2.0.20210524192334-209527eccc6c
 	github.com/talos-systems/talos/pkg/machinery v0.0.0-20210524192334-209527eccc6c
+	golang.zx2c4.com/wireguard/wgctrl v0.0.0-20210427135350-f9ad6d392236
 	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b
 )
@@ -0,0 +1,74 @@
+package talos
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1/machine"
+)
+
+func externalCloudProviderSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Required: false,
+		Optional: true,
+		MaxItems: 1,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"enabled": {
+					Type:     schema.TypeBool,
+					Required: false,
+					Optional: true,
+					Default:  true,
+				},
+				"manifests": extraManifestsSchema(),
+			},
+		},
+	}
+}
+
+func expandExternalCloudProvider(ecp []interface{}) *v1alpha1.ExternalCloudProviderConfig {
+	if len(ecp) == 0 || ecp[0] == nil {
+		return nil
+	}
+
+	ecpConfig := ecp[0].(map[string]interface{})
+
+	return &v1alpha1.ExternalCloudProviderConfig{
+		ExternalEnabled:   ecpConfig["enabled"].(bool),
+		ExternalManifests: expandStringList(ecpConfig["manifests"].([]interface{})),
+	}
+}
+
+// validateExternalCloudProvider runs the Talos checks, and also fails when
+// the provider is enabled without manifests as nothing would initialize the
+// nodes then.
+func validateExternalCloudProvider(ecp *v1alpha1.ExternalCloudProviderConfig) error {
+	if ecp == nil {
+		return nil
+	}
+
+	if ecp.ExternalEnabled && len(ecp.ExternalManifests) == 0 {
+		return fmt.Errorf("external cloud provider is enabled, but no manifests are provided")
+	}
+
+	return ecp.Validate()
+}
+
+// withExternalCloudProvider sets the external cloud provider on every machine,
+// Talos then runs the kubelet and the control plane with
+// --cloud-provider=external and the control plane applies the manifests. A
+// disabled provider is left out, so that Talos versions without it accept the
+// config.
+func withExternalCloudProvider(ecp *v1alpha1.ExternalCloudProviderConfig) configOption {
+	return func(_ machine.Type, cfg *v1alpha1.Config) error {
+		if ecp == nil || !ecp.ExternalEnabled {
+			return nil
+		}
+
+		cfg.ClusterConfig.ExternalCloudProviderConfig = ecp
+
+		return nil
+	}
+}
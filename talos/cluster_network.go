@@ -0,0 +1,206 @@
+package talos
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1/machine"
+	"github.com/talos-systems/talos/pkg/machinery/constants"
+)
+
+func clusterSubnetsSchema() *schema.Schema {
+	return &schema.Schema{
+		Type: schema.TypeList,
+		Elem: &schema.Schema{
+			Type:         schema.TypeString,
+			ValidateFunc: validateCIDR,
+		},
+		Required: false,
+		Optional: true,
+		MaxItems: 2,
+	}
+}
+
+// validateEndpoint requires an HTTPS URL with IPv6 addresses in brackets, as
+// an unbracketed address can't be told apart from the port.
+func validateEndpoint(v interface{}, k string) ([]string, []error) {
+	value := v.(string)
+
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, []error{fmt.Errorf("%q: %q is not a valid HTTPS URL", k, value)}
+	}
+
+	if !strings.HasPrefix(u.Host, "[") && strings.Count(u.Host, ":") > 1 {
+		return nil, []error{fmt.Errorf("%q: IPv6 addresses should be in brackets, like https://[%s]:6443", k, u.Host)}
+	}
+
+	return nil, nil
+}
+
+func endpointHostname(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return ""
+	}
+
+	return u.Hostname()
+}
+
+func isIPv6(ip net.IP) bool {
+	return ip != nil && ip.To4() == nil
+}
+
+// defaultClusterSubnets mirrors the defaults generate.NewInput intends to
+// pick, which it misses for IPv6 endpoints as it doesn't parse the URL.
+func defaultClusterSubnets(endpoint string) (podSubnets, serviceSubnets []string) {
+	if isIPv6(net.ParseIP(endpointHostname(endpoint))) {
+		return []string{constants.DefaultIPv6PodNet}, []string{constants.DefaultIPv6ServiceNet}
+	}
+
+	return []string{constants.DefaultIPv4PodNet}, []string{constants.DefaultIPv4ServiceNet}
+}
+
+// clusterSubnetFamilies parses the subnets, allowing at most one subnet per IP
+// family for dual-stack clusters.
+func clusterSubnetFamilies(name string, subnets []string) (map[bool]*net.IPNet, error) {
+	result := map[bool]*net.IPNet{}
+
+	for _, subnet := range subnets {
+		_, network, err := net.ParseCIDR(subnet)
+		if err != nil {
+			return nil, fmt.Errorf("%s %q is not a valid CIDR: %w", name, subnet, err)
+		}
+
+		family := isIPv6(network.IP)
+
+		if _, ok := result[family]; ok {
+			return nil, fmt.Errorf("%s should have at most one IPv4 and one IPv6 subnet", name)
+		}
+
+		result[family] = network
+	}
+
+	return result, nil
+}
+
+func subnetsOverlap(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// validateClusterSubnets checks that the pod and service subnets parse, cover
+// the same IP families and don't overlap each other or the node addresses.
+func validateClusterSubnets(podSubnets, serviceSubnets []string, nodeAddresses []net.IP) error {
+	var result *multierror.Error
+
+	pods, err := clusterSubnetFamilies("pod_subnets", podSubnets)
+	if err != nil {
+		return err
+	}
+
+	services, err := clusterSubnetFamilies("service_subnets", serviceSubnets)
+	if err != nil {
+		return err
+	}
+
+	sameFamilies := len(pods) == len(services)
+
+	for _, family := range []bool{false, true} {
+		pod, podOK := pods[family]
+		service, serviceOK := services[family]
+
+		if podOK != serviceOK {
+			sameFamilies = false
+		}
+
+		if podOK && serviceOK && subnetsOverlap(pod, service) {
+			result = multierror.Append(result, fmt.Errorf("pod subnet %s overlaps with service subnet %s", pod, service))
+		}
+	}
+
+	if !sameFamilies {
+		result = multierror.Append(result, fmt.Errorf("pod_subnets and service_subnets should cover the same IP families"))
+	}
+
+	for _, ip := range nodeAddresses {
+		for _, subnet := range []map[bool]*net.IPNet{pods, services} {
+			if network, ok := subnet[isIPv6(ip)]; ok && network.Contains(ip) {
+				result = multierror.Append(result, fmt.Errorf("node address %s is within the cluster subnet %s", ip, network))
+			}
+		}
+	}
+
+	return result.ErrorOrNil()
+}
+
+// parseNodeAddresses returns the IP addresses among the endpoints and nodes,
+// skipping hostnames.
+func parseNodeAddresses(hosts ...string) []net.IP {
+	var result []net.IP
+
+	for _, host := range hosts {
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+
+		if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil {
+			result = append(result, ip)
+		}
+	}
+
+	return result
+}
+
+// withClusterNetwork sets the pod and service subnets, checking them against
+// the static addresses of the machine, and adds the endpoint host to the API
+// server SANs when generate.Input.GetAPIServerSANs misses it as the endpoint
+// has no port.
+func withClusterNetwork(podSubnets, serviceSubnets []string, endpoint string, nodeAddresses []net.IP) configOption {
+	return func(machineType machine.Type, cfg *v1alpha1.Config) error {
+		if err := validateClusterSubnets(podSubnets, serviceSubnets, append(staticAddresses(cfg), nodeAddresses...)); err != nil {
+			return fmt.Errorf("invalid cluster network config: %w", err)
+		}
+
+		if cfg.ClusterConfig.ClusterNetwork == nil {
+			cfg.ClusterConfig.ClusterNetwork = &v1alpha1.ClusterNetworkConfig{}
+		}
+
+		cfg.ClusterConfig.ClusterNetwork.PodSubnet = podSubnets
+		cfg.ClusterConfig.ClusterNetwork.ServiceSubnet = serviceSubnets
+
+		if machineType == machine.TypeJoin || cfg.ClusterConfig.APIServerConfig == nil {
+			return nil
+		}
+
+		apiServer := cfg.ClusterConfig.APIServerConfig
+
+		if host := endpointHostname(endpoint); host != "" && !stringInSlice(host, apiServer.CertSANs) {
+			apiServer.CertSANs = append([]string{host}, apiServer.CertSANs...)
+		}
+
+		return nil
+	}
+}
+
+// expandClusterSubnets returns the pod and service subnets, defaulting each
+// to the subnet for the IP family of the endpoint.
+func expandClusterSubnets(d resourceData) (podSubnets, serviceSubnets []string) {
+	defaultPodSubnets, defaultServiceSubnets := defaultClusterSubnets(d.Get("endpoint").(string))
+
+	podSubnets = expandStringList(d.Get("pod_subnets").([]interface{}))
+	if len(podSubnets) == 0 {
+		podSubnets = defaultPodSubnets
+	}
+
+	serviceSubnets = expandStringList(d.Get("service_subnets").([]interface{}))
+	if len(serviceSubnets) == 0 {
+		serviceSubnets = defaultServiceSubnets
+	}
+
+	return podSubnets, serviceSubnets
+}
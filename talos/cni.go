@@ -0,0 +1,73 @@
+package talos
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1"
+	"github.com/talos-systems/talos/pkg/machinery/constants"
+)
+
+func cniSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Required: false,
+		Optional: true,
+		MaxItems: 1,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"name": {
+					Type:     schema.TypeString,
+					Required: false,
+					Optional: true,
+					Default:  constants.FlannelCNI,
+				},
+				"urls": {
+					Type: schema.TypeList,
+					Elem: &schema.Schema{
+						Type: schema.TypeString,
+					},
+					Required: false,
+					Optional: true,
+				},
+			},
+		},
+	}
+}
+
+func expandCNIConfig(cni []interface{}) *v1alpha1.CNIConfig {
+	if len(cni) == 0 || cni[0] == nil {
+		return nil
+	}
+
+	cniConfig := cni[0].(map[string]interface{})
+
+	result := &v1alpha1.CNIConfig{
+		CNIName: cniConfig["name"].(string),
+	}
+
+	for _, url := range cniConfig["urls"].([]interface{}) {
+		result.CNIUrls = append(result.CNIUrls, url.(string))
+	}
+
+	return result
+}
+
+// validateCNIConfig runs v1alpha1.ValidateCNI, failing on its warnings too as
+// a custom CNI without manifests leaves the cluster without networking.
+func validateCNIConfig(cniConfig *v1alpha1.CNIConfig) error {
+	if cniConfig == nil {
+		return nil
+	}
+
+	warnings, err := v1alpha1.ValidateCNI(cniConfig)
+
+	result := multierror.Append(nil, err)
+
+	for _, warning := range warnings {
+		result = multierror.Append(result, fmt.Errorf("%s", warning))
+	}
+
+	return result.ErrorOrNil()
+}
@@ -0,0 +1,140 @@
+package talos
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1/bundle"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1/generate"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1/machine"
+)
+
+const defaultTalosEndpoint = "127.0.0.1"
+
+// configOption adjusts a generated machine config, covering the parts of
+// v1alpha1.Config that generate.GenOption can't reach.
+type configOption func(machineType machine.Type, cfg *v1alpha1.Config) error
+
+// newConfigBundle is bundle.NewConfigBundle for an existing secrets bundle,
+// so that configs can be regenerated without minting a new cluster identity.
+// When secrets is nil a new secrets bundle is generated. JSON patches are left
+// to genV1Alpha1Config.
+func newConfigBundle(secrets *generate.SecretsBundle, configOptions []configOption, opts ...bundle.Option) (*v1alpha1.ConfigBundle, error) {
+	options := bundle.DefaultOptions()
+
+	for _, opt := range opts {
+		if err := opt(&options); err != nil {
+			return nil, err
+		}
+	}
+
+	if options.InputOptions == nil {
+		return nil, fmt.Errorf("no WithInputOptions is defined")
+	}
+
+	var err error
+
+	if secrets == nil {
+		secrets, err = generate.NewSecretsBundle(generate.NewClock(), options.InputOptions.GenOptions...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// NewInput mints an admin certificate, keep the one from the secrets.
+	adminCert := secrets.Certs.Admin
+
+	input, err := generate.NewInput(
+		options.InputOptions.ClusterName,
+		options.InputOptions.Endpoint,
+		options.InputOptions.KubeVersion,
+		secrets,
+		options.InputOptions.GenOptions...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if adminCert != nil {
+		input.Certs.Admin = adminCert
+	}
+
+	configBundle := &v1alpha1.ConfigBundle{}
+
+	for _, configType := range []machine.Type{machine.TypeInit, machine.TypeControlPlane, machine.TypeJoin} {
+		generatedConfig, err := generateConfig(configType, input, configOptions...)
+		if err != nil {
+			return nil, err
+		}
+
+		switch configType { //nolint:exhaustive
+		case machine.TypeInit:
+			configBundle.InitCfg = generatedConfig
+		case machine.TypeControlPlane:
+			configBundle.ControlPlaneCfg = generatedConfig
+		case machine.TypeJoin:
+			configBundle.JoinCfg = generatedConfig
+		}
+	}
+
+	configBundle.TalosCfg, err = generate.Talosconfig(input, options.InputOptions.GenOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	return configBundle, nil
+}
+
+// generateConfig is generate.Config followed by the config options.
+func generateConfig(machineType machine.Type, input *generate.Input, configOptions ...configOption) (*v1alpha1.Config, error) {
+	generatedConfig, err := generate.Config(machineType, input)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, opt := range configOptions {
+		if err = opt(machineType, generatedConfig); err != nil {
+			return nil, err
+		}
+	}
+
+	return generatedConfig, nil
+}
+
+// genV1Alpha1Config mirrors mgmt.GenV1Alpha1Config on top of newConfigBundle.
+// The JSON patches are applied in order.
+func genV1Alpha1Config(secrets *generate.SecretsBundle,
+	genOptions []generate.GenOption,
+	configOptions []configOption,
+	clusterName string,
+	endpoint string,
+	kubernetesVersion string,
+	patches []jsonPatch) (*v1alpha1.ConfigBundle, error) {
+	configBundle, err := newConfigBundle(secrets, configOptions,
+		bundle.WithInputOptions(
+			&bundle.InputOptions{
+				ClusterName: clusterName,
+				Endpoint:    endpoint,
+				KubeVersion: strings.TrimPrefix(kubernetesVersion, "v"),
+				GenOptions:  genOptions,
+			},
+		),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate config bundle: %w", err)
+	}
+
+	for _, patch := range patches {
+		if err = applyJSONPatch(configBundle, patch); err != nil {
+			return nil, err
+		}
+	}
+
+	// Without a Talos endpoint list, default to talosctl's loopback endpoint.
+	if talosContext := configBundle.TalosConfig().Contexts[clusterName]; len(talosContext.Endpoints) == 0 {
+		talosContext.Endpoints = []string{defaultTalosEndpoint}
+	}
+
+	return configBundle, nil
+}
@@ -0,0 +1,194 @@
+package talos
+
+import (
+	"fmt"
+
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1/generate"
+)
+
+// configInput is what the machine configs are generated from, shared by
+// talos_cluster_config and talos_machine_configuration so that both render
+// the same config for the same cluster.
+type configInput struct {
+	clusterName       string
+	endpoint          string
+	kubernetesVersion string
+	genOptions        []generate.GenOption
+	configOptions     []configOption
+}
+
+// expandConfigInput reads and validates the attributes both talos_cluster_config
+// and talos_machine_configuration have. nodes are the addresses of further
+// nodes the cluster subnets can't overlap. The config options stop short of
+// the role specific options and the merge patches, which the callers append.
+func expandConfigInput(d resourceData, secrets *generate.SecretsBundle, nodes []string) (*configInput, error) {
+	clusterName := d.Get("cluster_name").(string)
+	endpoint := d.Get("endpoint").(string)
+	talosEndpoints := expandStringList(d.Get("talos_endpoints").([]interface{}))
+	podSubnets, serviceSubnets := expandClusterSubnets(d)
+	nodeAddresses := parseNodeAddresses(append(append([]string{endpointHostname(endpoint)}, talosEndpoints...), nodes...)...)
+	installDisk := d.Get("install_disk").(string)
+	installImage := d.Get("install_image").(string)
+	kubernetesVersion := d.Get("kubernetes_version").(string)
+	talosVersion := d.Get("talos_version").(string)
+
+	networkOptions := expandNetworkOptions(d.Get("network").([]interface{}))
+	if err := validateNetworkOptions(networkOptions); err != nil {
+		return nil, fmt.Errorf("invalid network config: %w", err)
+	}
+
+	cniConfig := expandCNIConfig(d.Get("cni").([]interface{}))
+	if err := validateCNIConfig(cniConfig); err != nil {
+		return nil, fmt.Errorf("invalid CNI config: %w", err)
+	}
+
+	installDiskSelector, err := expandInstallDiskSelector(d.Get("install_disk_selector").([]interface{}))
+	if err != nil {
+		return nil, err
+	}
+
+	diskConflictCheck := installDisk
+	if installDiskSelector != nil {
+		// The selector picks the install disk on the node.
+		diskConflictCheck = ""
+	}
+
+	disks, err := expandDisks(d.Get("disk").([]interface{}))
+	if err != nil {
+		return nil, err
+	}
+
+	if err = validateDisks(disks, diskConflictCheck); err != nil {
+		return nil, fmt.Errorf("invalid disks config: %w", err)
+	}
+
+	inlineManifests := expandInlineManifests(d.Get("inline_manifest").([]interface{}))
+	if err = inlineManifests.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid inline manifests: %w", err)
+	}
+
+	externalCloudProvider := expandExternalCloudProvider(d.Get("external_cloud_provider").([]interface{}))
+	if err = validateExternalCloudProvider(externalCloudProvider); err != nil {
+		return nil, fmt.Errorf("invalid external cloud provider config: %w", err)
+	}
+
+	files, err := expandFiles(d.Get("file").([]interface{}))
+	if err != nil {
+		return nil, err
+	}
+
+	if err = validateFiles(files); err != nil {
+		return nil, fmt.Errorf("invalid files config: %w", err)
+	}
+
+	kubeletConfig := expandKubeletConfig(d.Get("kubelet").([]interface{}))
+	if err = validateKubeletConfig(kubeletConfig); err != nil {
+		return nil, fmt.Errorf("invalid kubelet config: %w", err)
+	}
+
+	controlPlaneConfig := expandControlPlaneConfig(d)
+	if err = validateControlPlaneConfig(controlPlaneConfig); err != nil {
+		return nil, fmt.Errorf("invalid control plane config: %w", err)
+	}
+
+	etcdConfig := expandEtcdConfig(d.Get("etcd").([]interface{}))
+	if err = validateEtcdConfig(etcdConfig); err != nil {
+		return nil, fmt.Errorf("invalid etcd config: %w", err)
+	}
+
+	versionContract, err := parseVersionContract(talosVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	systemDiskEncryption := expandSystemDiskEncryption(d.Get("system_disk_encryption").([]interface{}))
+	if err = validateSystemDiskEncryption(systemDiskEncryption, versionContract); err != nil {
+		return nil, fmt.Errorf("invalid system disk encryption config: %w", err)
+	}
+
+	if err = validateConfigInputContract(d, secrets); err != nil {
+		return nil, err
+	}
+
+	if installImage == "" {
+		installImage = defaultInstallImage(talosVersion, versionContract)
+	}
+
+	if kubernetesVersion == "" {
+		kubernetesVersion = defaultKubernetesVersion(versionContract)
+	}
+
+	genOptions := []generate.GenOption{
+		generate.WithVersionContract(versionContract),
+		generate.WithInstallDisk(installDisk),
+		generate.WithInstallImage(installImage),
+		generate.WithInstallExtraKernelArgs(expandStringList(d.Get("install_extra_kernel_args").([]interface{}))),
+		generate.WithAdditionalSubjectAltNames(expandStringList(d.Get("additional_sans").([]interface{}))),
+		generate.WithEndpointList(talosEndpoints),
+		generate.WithDNSDomain(d.Get("dns_domain").(string)),
+		generate.WithPersist(d.Get("persist_config").(bool)),
+		generate.WithNetworkOptions(networkOptions...),
+		generate.WithSystemDiskEncryption(systemDiskEncryption),
+		generate.WithUserDisks(machineDisks(disks)),
+		generate.WithClusterCNIConfig(cniConfig),
+	}
+
+	genOptions = append(genOptions, expandRegistriesOptions(d.Get("registries").([]interface{}))...)
+
+	configOptions := []configOption{
+		withInstallDiskSelector(installDiskSelector),
+		withClusterManifests(
+			inlineManifests,
+			expandStringList(d.Get("extra_manifests").([]interface{})),
+			expandStringMap(d.Get("extra_manifest_headers").(map[string]interface{})),
+		),
+		withMachineFiles(
+			files,
+			expandStringMap(d.Get("sysctls").(map[string]interface{})),
+			expandStringMap(d.Get("env").(map[string]interface{})),
+		),
+		withKubeletConfig(kubeletConfig, true, true),
+		withControlPlaneConfig(controlPlaneConfig),
+		withEtcdConfig(etcdConfig),
+		withClusterNetwork(podSubnets, serviceSubnets, endpoint, nodeAddresses),
+		withExternalCloudProvider(externalCloudProvider),
+	}
+
+	return &configInput{
+		clusterName:       clusterName,
+		endpoint:          endpoint,
+		kubernetesVersion: kubernetesVersion,
+		genOptions:        genOptions,
+		configOptions:     configOptions,
+	}, nil
+}
+
+// validateConfigInputContract fails for the features of the inputs that
+// talos_version doesn't support. It only reads the inputs, so that it can run
+// at plan time when the configs can't be generated yet.
+func validateConfigInputContract(d resourceData, secrets *generate.SecretsBundle) error {
+	talosVersion := d.Get("talos_version").(string)
+
+	versionContract, err := parseVersionContract(talosVersion)
+	if err != nil {
+		return err
+	}
+
+	installDiskSelector, err := expandInstallDiskSelector(d.Get("install_disk_selector").([]interface{}))
+	if err != nil {
+		return err
+	}
+
+	inlineManifests := expandInlineManifests(d.Get("inline_manifest").([]interface{}))
+	externalCloudProvider := expandExternalCloudProvider(d.Get("external_cloud_provider").([]interface{}))
+
+	if err = validateContractFeatures(versionContract, append(secretsContractFeatures(secrets),
+		contractFeature{"install_disk_selector", installDiskSelector != nil, supportsInstallDiskSelector, "v0.9"},
+		contractFeature{"inline_manifest", len(inlineManifests) > 0, supportsInlineManifests, "v0.9"},
+		contractFeature{"external_cloud_provider", externalCloudProvider != nil && externalCloudProvider.ExternalEnabled, supportsExternalCloudProvider, "v0.9"},
+	)); err != nil {
+		return fmt.Errorf("talos_version %q doesn't support the config: %w", talosVersion, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,158 @@
+package talos
+
+import (
+	"encoding/pem"
+	"fmt"
+	"regexp"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/talos-systems/crypto/x509"
+	"github.com/talos-systems/talos/pkg/machinery/config"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1/generate"
+	"github.com/talos-systems/talos/pkg/machinery/constants"
+)
+
+const (
+	defaultTalosVersion    = "v0.10.1"
+	defaultInstallerImage  = "ghcr.io/talos-systems/installer"
+	ecdsaPrivateKeyPEMType = "EC PRIVATE KEY"
+)
+
+var talosReleaseRegexp = regexp.MustCompile(`^v\d+\.\d+\.\d+`)
+
+// defaultKubernetesVersions are the Kubernetes versions older Talos releases
+// shipped with. The current release uses constants.DefaultKubernetesVersion.
+var defaultKubernetesVersions = map[config.VersionContract]string{
+	*config.TalosVersion0_8: "1.20.1",
+	*config.TalosVersion0_9: "1.20.5",
+}
+
+// defaultInstallerTags are the installer tags of older Talos releases, for a
+// talos_version without the patch version.
+var defaultInstallerTags = map[config.VersionContract]string{
+	*config.TalosVersion0_8: "v0.8.4",
+	*config.TalosVersion0_9: "v0.9.3",
+}
+
+// parseVersionContract returns the version contract for the talos_version
+// argument, where an empty version means the current one.
+func parseVersionContract(talosVersion string) (*config.VersionContract, error) {
+	if talosVersion == "" {
+		return config.TalosVersionCurrent, nil
+	}
+
+	return config.ParseContractFromVersion(talosVersion)
+}
+
+func defaultKubernetesVersion(contract *config.VersionContract) string {
+	if contract != nil {
+		if version, ok := defaultKubernetesVersions[*contract]; ok {
+			return version
+		}
+	}
+
+	return constants.DefaultKubernetesVersion
+}
+
+// defaultInstallImage is the installer of the Talos release when
+// talos_version names one, or of the latest release of the contract.
+func defaultInstallImage(talosVersion string, contract *config.VersionContract) string {
+	if talosReleaseRegexp.MatchString(talosVersion) {
+		return defaultInstallerImage + ":" + talosVersion
+	}
+
+	if contract != nil {
+		if tag, ok := defaultInstallerTags[*contract]; ok {
+			return defaultInstallerImage + ":" + tag
+		}
+	}
+
+	return defaultInstallerImage + ":" + defaultTalosVersion
+}
+
+// supportsSystemDiskEncryption reports whether the contract can parse the
+// systemDiskEncryption machine config section, which appeared in Talos 0.10.
+func supportsSystemDiskEncryption(contract *config.VersionContract) bool {
+	return contract.Greater(config.TalosVersion0_9)
+}
+
+// supportsInstallDiskSelector reports whether the contract can parse the
+// install diskSelector, which appeared in Talos 0.9.
+func supportsInstallDiskSelector(contract *config.VersionContract) bool {
+	return contract.Greater(config.TalosVersion0_8)
+}
+
+// supportsInlineManifests reports whether the contract can parse the cluster
+// inlineManifests, which appeared in Talos 0.9.
+func supportsInlineManifests(contract *config.VersionContract) bool {
+	return contract.Greater(config.TalosVersion0_8)
+}
+
+// supportsExternalCloudProvider reports whether the contract can parse the
+// cluster externalCloudProvider, which appeared in Talos 0.9.
+func supportsExternalCloudProvider(contract *config.VersionContract) bool {
+	return contract.Greater(config.TalosVersion0_8)
+}
+
+// contractFeature is a config feature that older Talos releases can't parse.
+type contractFeature struct {
+	name      string
+	used      bool
+	supported func(*config.VersionContract) bool
+	requires  string
+}
+
+// validateContractFeatures fails for every used feature the contract doesn't
+// support.
+func validateContractFeatures(contract *config.VersionContract, features []contractFeature) error {
+	var result *multierror.Error
+
+	for _, feature := range features {
+		if feature.used && !feature.supported(contract) {
+			result = multierror.Append(result, fmt.Errorf("%s requires Talos %s or later", feature.name, feature.requires))
+		}
+	}
+
+	return result.ErrorOrNil()
+}
+
+// secretsContractFeatures lists the machine secrets that only newer Talos
+// releases can parse.
+func secretsContractFeatures(secrets *generate.SecretsBundle) []contractFeature {
+	if secrets == nil {
+		return nil
+	}
+
+	usesECDSAKeys := false
+
+	for _, ca := range []*x509.PEMEncodedCertificateAndKey{secrets.Certs.Etcd, secrets.Certs.K8s} {
+		if ca == nil {
+			continue
+		}
+
+		if block, _ := pem.Decode(ca.Key); block != nil && block.Type == ecdsaPrivateKeyPEMType {
+			usesECDSAKeys = true
+		}
+	}
+
+	return []contractFeature{
+		{
+			name:      "machine secrets with ECDSA keys",
+			used:      usesECDSAKeys,
+			supported: (*config.VersionContract).SupportsECDSAKeys,
+			requires:  "v0.9",
+		},
+		{
+			name:      "machine secrets with an aggregator CA",
+			used:      secrets.Certs.K8sAggregator != nil,
+			supported: (*config.VersionContract).SupportsAggregatorCA,
+			requires:  "v0.9",
+		},
+		{
+			name:      "machine secrets with a service account key",
+			used:      secrets.Certs.K8sServiceAccount != nil,
+			supported: (*config.VersionContract).SupportsServiceAccount,
+			requires:  "v0.9",
+		},
+	}
+}
@@ -0,0 +1,334 @@
+package talos
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1/machine"
+)
+
+var proxyModes = []string{"iptables", "ipvs"}
+
+// managedExtraArgs are the flags Talos sets from the machine config and
+// secrets, overriding them would break the control plane.
+var managedExtraArgs = map[string][]string{
+	"apiserver": {
+		"advertise-address",
+		"client-ca-file",
+		"etcd-cafile",
+		"etcd-certfile",
+		"etcd-keyfile",
+		"etcd-servers",
+		"kubelet-client-certificate",
+		"kubelet-client-key",
+		"proxy-client-cert-file",
+		"proxy-client-key-file",
+		"requestheader-client-ca-file",
+		"service-account-issuer",
+		"service-account-key-file",
+		"service-account-signing-key-file",
+		"service-cluster-ip-range",
+		"tls-cert-file",
+		"tls-private-key-file",
+	},
+	"controller_manager": {
+		"authentication-kubeconfig",
+		"authorization-kubeconfig",
+		"cluster-cidr",
+		"cluster-signing-cert-file",
+		"cluster-signing-key-file",
+		"kubeconfig",
+		"root-ca-file",
+		"service-account-private-key-file",
+		"service-cluster-ip-range",
+	},
+	"scheduler": {
+		"authentication-kubeconfig",
+		"authorization-kubeconfig",
+		"kubeconfig",
+	},
+	"proxy": {
+		"cluster-cidr",
+		"kubeconfig",
+		"proxy-mode",
+	},
+	"etcd": {
+		"cert-file",
+		"data-dir",
+		"initial-cluster-state",
+		"key-file",
+		"listen-client-urls",
+		"listen-peer-urls",
+		"name",
+		"peer-cert-file",
+		"peer-client-cert-auth",
+		"peer-key-file",
+		"peer-trusted-ca-file",
+		"trusted-ca-file",
+	},
+}
+
+// controlPlaneConfig holds the Kubernetes control plane component settings.
+type controlPlaneConfig struct {
+	apiServer         *v1alpha1.APIServerConfig
+	controllerManager *v1alpha1.ControllerManagerConfig
+	scheduler         *v1alpha1.SchedulerConfig
+	proxy             *v1alpha1.ProxyConfig
+}
+
+func componentSchema(extra map[string]*schema.Schema) *schema.Schema {
+	fields := map[string]*schema.Schema{
+		"image": {
+			Type:     schema.TypeString,
+			Required: false,
+			Optional: true,
+			Default:  "",
+		},
+		"extra_args": extraArgsSchema(),
+	}
+
+	for key, value := range extra {
+		fields[key] = value
+	}
+
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Required: false,
+		Optional: true,
+		MaxItems: 1,
+		Elem: &schema.Resource{
+			Schema: fields,
+		},
+	}
+}
+
+func apiServerSchema() *schema.Schema {
+	return componentSchema(map[string]*schema.Schema{
+		"cert_sans": {
+			Type: schema.TypeList,
+			Elem: &schema.Schema{
+				Type: schema.TypeString,
+			},
+			Required: false,
+			Optional: true,
+		},
+	})
+}
+
+func controllerManagerSchema() *schema.Schema {
+	return componentSchema(nil)
+}
+
+func schedulerSchema() *schema.Schema {
+	return componentSchema(nil)
+}
+
+func proxySchema() *schema.Schema {
+	return componentSchema(map[string]*schema.Schema{
+		"mode": {
+			Type:         schema.TypeString,
+			Required:     false,
+			Optional:     true,
+			Default:      "iptables",
+			ValidateFunc: validateProxyMode,
+		},
+		"disabled": {
+			Type:     schema.TypeBool,
+			Required: false,
+			Optional: true,
+			Default:  false,
+		},
+	})
+}
+
+func validateProxyMode(v interface{}, k string) ([]string, []error) {
+	if !stringInSlice(v.(string), proxyModes) {
+		return nil, []error{fmt.Errorf("%q: proxy mode should be one of %q", k, proxyModes)}
+	}
+
+	return nil, nil
+}
+
+func expandComponent(component []interface{}) map[string]interface{} {
+	if len(component) == 0 || component[0] == nil {
+		return nil
+	}
+
+	return component[0].(map[string]interface{})
+}
+
+func expandControlPlaneConfig(d resourceData) *controlPlaneConfig {
+	result := &controlPlaneConfig{}
+
+	if apiServer := expandComponent(d.Get("apiserver").([]interface{})); apiServer != nil {
+		result.apiServer = &v1alpha1.APIServerConfig{
+			ContainerImage:  apiServer["image"].(string),
+			ExtraArgsConfig: expandStringMap(apiServer["extra_args"].(map[string]interface{})),
+			CertSANs:        expandStringList(apiServer["cert_sans"].([]interface{})),
+		}
+	}
+
+	if controllerManager := expandComponent(d.Get("controller_manager").([]interface{})); controllerManager != nil {
+		result.controllerManager = &v1alpha1.ControllerManagerConfig{
+			ContainerImage:  controllerManager["image"].(string),
+			ExtraArgsConfig: expandStringMap(controllerManager["extra_args"].(map[string]interface{})),
+		}
+	}
+
+	if scheduler := expandComponent(d.Get("scheduler").([]interface{})); scheduler != nil {
+		result.scheduler = &v1alpha1.SchedulerConfig{
+			ContainerImage:  scheduler["image"].(string),
+			ExtraArgsConfig: expandStringMap(scheduler["extra_args"].(map[string]interface{})),
+		}
+	}
+
+	if proxy := expandComponent(d.Get("proxy").([]interface{})); proxy != nil {
+		result.proxy = &v1alpha1.ProxyConfig{
+			Disabled:        proxy["disabled"].(bool),
+			ContainerImage:  proxy["image"].(string),
+			ModeConfig:      proxy["mode"].(string),
+			ExtraArgsConfig: expandStringMap(proxy["extra_args"].(map[string]interface{})),
+		}
+	}
+
+	return result
+}
+
+// validateControlPlaneConfig rejects extra args overriding the flags managed
+// by Talos and empty certificate SANs.
+func validateControlPlaneConfig(c *controlPlaneConfig) error {
+	var result *multierror.Error
+
+	if c.apiServer != nil {
+		result = multierror.Append(result, validateManagedExtraArgs("apiserver", c.apiServer.ExtraArgsConfig))
+
+		for _, san := range c.apiServer.CertSANs {
+			if san == "" {
+				result = multierror.Append(result, fmt.Errorf("apiserver: cert SANs can't be empty"))
+			}
+		}
+	}
+
+	if c.controllerManager != nil {
+		result = multierror.Append(result, validateManagedExtraArgs("controller_manager", c.controllerManager.ExtraArgsConfig))
+	}
+
+	if c.scheduler != nil {
+		result = multierror.Append(result, validateManagedExtraArgs("scheduler", c.scheduler.ExtraArgsConfig))
+	}
+
+	if c.proxy != nil {
+		result = multierror.Append(result, validateManagedExtraArgs("proxy", c.proxy.ExtraArgsConfig))
+	}
+
+	return result.ErrorOrNil()
+}
+
+func validateManagedExtraArgs(component string, extraArgs map[string]string) error {
+	var result *multierror.Error
+
+	keys := make([]string, 0, len(extraArgs))
+
+	for key := range extraArgs {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if stringInSlice(key, managedExtraArgs[component]) {
+			result = multierror.Append(result, fmt.Errorf("%s: --%s is managed by Talos and can't be overridden", component, key))
+		}
+	}
+
+	return result.ErrorOrNil()
+}
+
+func mergeExtraArgs(extraArgs, overrides map[string]string) map[string]string {
+	if len(overrides) == 0 {
+		return extraArgs
+	}
+
+	if extraArgs == nil {
+		extraArgs = map[string]string{}
+	}
+
+	for key, value := range overrides {
+		extraArgs[key] = value
+	}
+
+	return extraArgs
+}
+
+// withControlPlaneConfig applies the component settings to the control plane
+// configs, images are only overridden when set.
+func withControlPlaneConfig(c *controlPlaneConfig) configOption {
+	return func(machineType machine.Type, cfg *v1alpha1.Config) error {
+		if machineType == machine.TypeJoin {
+			return nil
+		}
+
+		cluster := cfg.ClusterConfig
+
+		if c.apiServer != nil {
+			if cluster.APIServerConfig == nil {
+				cluster.APIServerConfig = &v1alpha1.APIServerConfig{}
+			}
+
+			if c.apiServer.ContainerImage != "" {
+				cluster.APIServerConfig.ContainerImage = c.apiServer.ContainerImage
+			}
+
+			cluster.APIServerConfig.ExtraArgsConfig = mergeExtraArgs(cluster.APIServerConfig.ExtraArgsConfig, c.apiServer.ExtraArgsConfig)
+
+			for _, san := range c.apiServer.CertSANs {
+				if !stringInSlice(san, cluster.APIServerConfig.CertSANs) {
+					cluster.APIServerConfig.CertSANs = append(cluster.APIServerConfig.CertSANs, san)
+				}
+			}
+		}
+
+		if c.controllerManager != nil {
+			if cluster.ControllerManagerConfig == nil {
+				cluster.ControllerManagerConfig = &v1alpha1.ControllerManagerConfig{}
+			}
+
+			if c.controllerManager.ContainerImage != "" {
+				cluster.ControllerManagerConfig.ContainerImage = c.controllerManager.ContainerImage
+			}
+
+			cluster.ControllerManagerConfig.ExtraArgsConfig = mergeExtraArgs(cluster.ControllerManagerConfig.ExtraArgsConfig, c.controllerManager.ExtraArgsConfig)
+		}
+
+		if c.scheduler != nil {
+			if cluster.SchedulerConfig == nil {
+				cluster.SchedulerConfig = &v1alpha1.SchedulerConfig{}
+			}
+
+			if c.scheduler.ContainerImage != "" {
+				cluster.SchedulerConfig.ContainerImage = c.scheduler.ContainerImage
+			}
+
+			cluster.SchedulerConfig.ExtraArgsConfig = mergeExtraArgs(cluster.SchedulerConfig.ExtraArgsConfig, c.scheduler.ExtraArgsConfig)
+		}
+
+		if c.proxy != nil {
+			if cluster.ProxyConfig == nil {
+				cluster.ProxyConfig = &v1alpha1.ProxyConfig{}
+			}
+
+			if c.proxy.ContainerImage != "" {
+				cluster.ProxyConfig.ContainerImage = c.proxy.ContainerImage
+			}
+
+			cluster.ProxyConfig.Disabled = c.proxy.Disabled
+			cluster.ProxyConfig.ModeConfig = c.proxy.ModeConfig
+			cluster.ProxyConfig.ExtraArgsConfig = mergeExtraArgs(cluster.ProxyConfig.ExtraArgsConfig, c.proxy.ExtraArgsConfig)
+		}
+
+		return nil
+	}
+}
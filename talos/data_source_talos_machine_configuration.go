@@ -0,0 +1,249 @@
+package talos
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/talos-systems/talos/pkg/machinery/config/encoder"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1/generate"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1/machine"
+)
+
+func dataSourceTalosMachineConfiguration() *schema.Resource {
+	return &schema.Resource{
+		ReadContext: dataSourceTalosMachineConfigurationRead,
+
+		Schema: map[string]*schema.Schema{
+			"cluster_name": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"endpoint": {
+				Type:         schema.TypeString,
+				Required:     true,
+				ValidateFunc: validateEndpoint,
+			},
+			"machine_secrets": {
+				Type:      schema.TypeString,
+				Required:  true,
+				Sensitive: true,
+			},
+			"machine_type": {
+				Type:         schema.TypeString,
+				Required:     true,
+				ValidateFunc: validateMachineType,
+			},
+			"dns_domain": {
+				Type:     schema.TypeString,
+				Required: false,
+				Optional: true,
+				Default:  "cluster.local",
+			},
+			"additional_sans": {
+				Type: schema.TypeList,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+				Required: false,
+				Optional: true,
+			},
+			"pod_subnets":     clusterSubnetsSchema(),
+			"service_subnets": clusterSubnetsSchema(),
+			"talos_endpoints": {
+				Type:     schema.TypeList,
+				Required: false,
+				Optional: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"kubernetes_version": {
+				Type:     schema.TypeString,
+				Required: false,
+				Optional: true,
+				Default:  "",
+			},
+			"talos_version": {
+				Type:     schema.TypeString,
+				Required: false,
+				Optional: true,
+				Default:  "",
+			},
+			"hostname": {
+				Type:     schema.TypeString,
+				Required: false,
+				Optional: true,
+				Default:  "",
+			},
+			"install_disk": {
+				Type:     schema.TypeString,
+				Required: false,
+				Optional: true,
+				Default:  "/dev/sda",
+			},
+			"install_disk_selector": installDiskSelectorSchema(),
+			"install_extra_kernel_args": {
+				Type:     schema.TypeList,
+				Required: false,
+				Optional: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"install_image": {
+				Type:     schema.TypeString,
+				Required: false,
+				Optional: true,
+				Default:  "",
+			},
+			"persist_config": {
+				Type:     schema.TypeBool,
+				Required: false,
+				Optional: true,
+				Default:  true,
+			},
+			"cni":                     cniSchema(),
+			"disk":                    disksSchema(),
+			"extra_manifests":         extraManifestsSchema(),
+			"extra_manifest_headers":  extraManifestHeadersSchema(),
+			"inline_manifest":         inlineManifestSchema(),
+			"external_cloud_provider": externalCloudProviderSchema(),
+			"network":                 networkSchema(),
+			"file":                    filesSchema(),
+			"sysctls":                 sysctlsSchema(),
+			"env":                     envSchema(),
+			"kubelet":                 machineKubeletSchema(),
+			"apiserver":               apiServerSchema(),
+			"controller_manager":      controllerManagerSchema(),
+			"scheduler":               schedulerSchema(),
+			"proxy":                   proxySchema(),
+			"etcd":                    machineEtcdSchema(),
+			"registries":              registriesSchema(),
+			"system_disk_encryption":  systemDiskEncryptionSchema(),
+			"runtime_mode": {
+				Type:         schema.TypeString,
+				Required:     false,
+				Optional:     true,
+				Default:      string(runtimeModeMetal),
+				ValidateFunc: validateRuntimeMode,
+			},
+			"strict_validation": {
+				Type:     schema.TypeBool,
+				Required: false,
+				Optional: true,
+				Default:  false,
+			},
+			"config_merge_patch": {
+				Type:         schema.TypeString,
+				Required:     false,
+				Optional:     true,
+				Default:      "",
+				ValidateFunc: validateMergePatch,
+			},
+			"config_merge_patches": {
+				Type:     schema.TypeList,
+				Required: false,
+				Optional: true,
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validateMergePatch,
+				},
+			},
+			"machine_configuration": {
+				Type:      schema.TypeString,
+				Computed:  true,
+				Sensitive: true,
+			},
+		},
+	}
+}
+
+func dataSourceTalosMachineConfigurationRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	warnings, err := dataSourceTalosMachineConfigurationGenerate(d)
+
+	diags := warningDiagnostics(warnings)
+	if err != nil {
+		diags = append(diags, diag.FromErr(err)...)
+	}
+
+	return diags
+}
+
+func dataSourceTalosMachineConfigurationGenerate(d *schema.ResourceData) ([]string, error) {
+	machineType, err := parseMachineType(d.Get("machine_type").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	secrets, err := unmarshalSecretsBundle(d.Get("machine_secrets").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	configInput, err := expandConfigInput(d, secrets, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	genOptions := configInput.genOptions
+
+	if hostname := d.Get("hostname").(string); hostname != "" {
+		genOptions = append(genOptions, generate.WithNetworkOptions(withNetworkHostname(hostname)))
+	}
+
+	input, err := generate.NewInput(configInput.clusterName, configInput.endpoint, strings.TrimPrefix(configInput.kubernetesVersion, "v"), secrets, genOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	configOptions := append(configInput.configOptions, withMergePatch(d.Get("config_merge_patch").(string), true, true))
+
+	// The patches are applied in order after config_merge_patch, so that a
+	// node can combine shared patches, such as the wireguard mesh, with its
+	// own.
+	for _, patch := range expandStringList(d.Get("config_merge_patches").([]interface{})) {
+		configOptions = append(configOptions, withMergePatch(patch, true, true))
+	}
+
+	machineConfig, err := generateConfig(machineType, input, configOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	warnings, err := validateMachineConfig(machineType, machineConfig, runtimeMode(d.Get("runtime_mode").(string)), d.Get("strict_validation").(bool))
+	if err != nil {
+		return warnings, err
+	}
+
+	machineConfiguration, err := machineConfig.String(encoder.WithComments(encoder.CommentsDisabled))
+	if err != nil {
+		return warnings, err
+	}
+
+	if err = d.Set("machine_configuration", machineConfiguration); err != nil {
+		return warnings, err
+	}
+
+	d.SetId(fmt.Sprintf("%x", sha256.Sum256([]byte(machineConfiguration))))
+
+	return warnings, nil
+}
+
+// parseMachineType is machine.ParseType limited to the types a config can be
+// generated for.
+func parseMachineType(t string) (machine.Type, error) {
+	machineType, err := machine.ParseType(t)
+	if err != nil {
+		return machineType, err
+	}
+
+	if machineType == machine.TypeUnknown {
+		return machineType, fmt.Errorf("machine type should be one of [%q, %q, %q]", machine.TypeInit, machine.TypeControlPlane, machine.TypeJoin)
+	}
+
+	return machineType, nil
+}
@@ -0,0 +1,255 @@
+package talos
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/talos-systems/talos/pkg/machinery/config/configloader"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1/generate"
+)
+
+func TestDataSourceTalosMachineConfigurationGenerate(t *testing.T) {
+	secrets, err := generate.NewSecretsBundle(generate.NewClock())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	machineSecrets, err := marshalSecretsBundle(secrets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	network := []interface{}{
+		map[string]interface{}{
+			"interface": []interface{}{
+				map[string]interface{}{
+					"name": "eth0",
+					"cidr": "192.168.1.10/24",
+				},
+				map[string]interface{}{
+					"name": "eth1",
+					"cidr": "10.10.0.10/16",
+				},
+				map[string]interface{}{
+					"name": "eth2",
+					"cidr": "fd00:10::10/64",
+				},
+			},
+		},
+	}
+
+	for _, tt := range []struct {
+		name    string
+		raw     map[string]interface{}
+		check   func(t *testing.T, cfg *v1alpha1.Config)
+		errPart string
+	}{
+		{
+			name: "etcd advertised subnets",
+			raw: map[string]interface{}{
+				"machine_type": "controlplane",
+				"network":      network,
+				"etcd": []interface{}{
+					map[string]interface{}{
+						"advertised_subnets": []interface{}{"10.10.0.0/16"},
+					},
+				},
+			},
+			check: func(t *testing.T, cfg *v1alpha1.Config) {
+				extraArgs := cfg.ClusterConfig.EtcdConfig.EtcdExtraArgs
+
+				if extraArgs["advertise-client-urls"] != "https://10.10.0.10:2379" || extraArgs["initial-advertise-peer-urls"] != "https://10.10.0.10:2380" {
+					t.Errorf("unexpected etcd advertised URLs %v", extraArgs)
+				}
+			},
+		},
+		{
+			name: "etcd advertised IPv6 subnet",
+			raw: map[string]interface{}{
+				"machine_type": "init",
+				"network":      network,
+				"etcd": []interface{}{
+					map[string]interface{}{
+						"advertised_subnets": []interface{}{"fd00:10::/64"},
+					},
+				},
+			},
+			check: func(t *testing.T, cfg *v1alpha1.Config) {
+				extraArgs := cfg.ClusterConfig.EtcdConfig.EtcdExtraArgs
+
+				if extraArgs["advertise-client-urls"] != "https://[fd00:10::10]:2379" || extraArgs["initial-advertise-peer-urls"] != "https://[fd00:10::10]:2380" {
+					t.Errorf("unexpected etcd advertised URLs %v", extraArgs)
+				}
+			},
+		},
+		{
+			name: "etcd advertised subnet without a static address",
+			raw: map[string]interface{}{
+				"machine_type": "controlplane",
+				"network":      network,
+				"etcd": []interface{}{
+					map[string]interface{}{
+						"advertised_subnets": []interface{}{"172.16.0.0/12"},
+					},
+				},
+			},
+			errPart: "no static address in the advertised subnets",
+		},
+		{
+			name: "kubelet node IP",
+			raw: map[string]interface{}{
+				"network": network,
+				"kubelet": []interface{}{
+					map[string]interface{}{
+						"node_ip_subnets": []interface{}{"10.10.0.0/16", "fd00:10::/64"},
+					},
+				},
+			},
+			check: func(t *testing.T, cfg *v1alpha1.Config) {
+				if nodeIP := cfg.MachineConfig.MachineKubelet.KubeletExtraArgs["node-ip"]; nodeIP != "10.10.0.10,fd00:10::10" {
+					t.Errorf("unexpected node IP %q", nodeIP)
+				}
+			},
+		},
+		{
+			name: "kubelet node IP without a static address",
+			raw: map[string]interface{}{
+				"network": network,
+				"kubelet": []interface{}{
+					map[string]interface{}{
+						"node_ip_subnets": []interface{}{"172.16.0.0/12"},
+					},
+				},
+			},
+			errPart: "no static address in the node IP subnet 172.16.0.0/12",
+		},
+		{
+			name: "kubelet node IP with node-ip extra arg",
+			raw: map[string]interface{}{
+				"network": network,
+				"kubelet": []interface{}{
+					map[string]interface{}{
+						"extra_args": map[string]interface{}{
+							"node-ip": "10.10.0.10",
+						},
+						"node_ip_subnets": []interface{}{"10.10.0.0/16"},
+					},
+				},
+			},
+			errPart: "--node-ip is set from node_ip_subnets",
+		},
+	} {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			raw := map[string]interface{}{
+				"cluster_name":    "test",
+				"endpoint":        "https://10.0.0.10:6443",
+				"machine_secrets": machineSecrets,
+				"machine_type":    "join",
+			}
+
+			for key, value := range tt.raw {
+				raw[key] = value
+			}
+
+			d := schema.TestResourceDataRaw(t, dataSourceTalosMachineConfiguration().Schema, raw)
+
+			_, err := dataSourceTalosMachineConfigurationGenerate(d)
+			if tt.errPart != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errPart) {
+					t.Fatalf("expected an error containing %q, got %v", tt.errPart, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			provider, err := configloader.NewFromBytes([]byte(d.Get("machine_configuration").(string)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tt.check(t, provider.(*v1alpha1.Config))
+		})
+	}
+}
+
+func TestDataSourceTalosMachineConfigurationMatchesClusterConfig(t *testing.T) {
+	secrets, err := generate.NewSecretsBundle(generate.NewClock())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	machineSecrets, err := marshalSecretsBundle(secrets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shared := map[string]interface{}{
+		"cluster_name":    "test",
+		"endpoint":        "https://10.0.0.10:6443",
+		"machine_secrets": machineSecrets,
+		"additional_sans": []interface{}{"api.example.com"},
+		"talos_endpoints": []interface{}{"10.0.0.11", "10.0.0.12"},
+		"persist_config":  false,
+		"install_disk":    "/dev/vda",
+		"network": []interface{}{
+			map[string]interface{}{
+				"interface": []interface{}{
+					map[string]interface{}{
+						"name": "eth0",
+						"cidr": "10.0.0.11/24",
+					},
+				},
+			},
+		},
+		"kubelet": []interface{}{
+			map[string]interface{}{
+				"extra_args": map[string]interface{}{
+					"rotate-server-certificates": "true",
+				},
+			},
+		},
+		"config_merge_patch": "machine:\n  sysctls:\n    net.ipv4.ip_forward: \"1\"\n",
+	}
+
+	cluster := schema.TestResourceDataRaw(t, resourceTalosClusterConfig().Schema, shared)
+
+	if _, err = resourceTalosClusterConfigGenerate(cluster, secrets); err != nil {
+		t.Fatal(err)
+	}
+
+	for machineType, output := range map[string]string{
+		"init":         "bootstrap_user_data",
+		"controlplane": "controlplane_user_data",
+		"join":         "join_user_data",
+	} {
+		machineType, output := machineType, output
+
+		t.Run(machineType, func(t *testing.T) {
+			raw := map[string]interface{}{
+				"machine_type": machineType,
+			}
+
+			for key, value := range shared {
+				raw[key] = value
+			}
+
+			d := schema.TestResourceDataRaw(t, dataSourceTalosMachineConfiguration().Schema, raw)
+
+			if _, err := dataSourceTalosMachineConfigurationGenerate(d); err != nil {
+				t.Fatal(err)
+			}
+
+			if machineConfiguration := d.Get("machine_configuration").(string); machineConfiguration != cluster.Get(output).(string) {
+				t.Fatalf("the %s config differs from %s:\n%s\n\n%s", machineType, output, machineConfiguration, cluster.Get(output))
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package talos
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1"
+)
+
+func disksSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Required: false,
+		Optional: true,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"device": {
+					Type:     schema.TypeString,
+					Required: true,
+				},
+				// size is the capacity of the device, only used to check
+				// that the partitions fit.
+				"size": {
+					Type:         schema.TypeString,
+					Required:     false,
+					Optional:     true,
+					Default:      "",
+					ValidateFunc: validateDiskSize,
+				},
+				"partition": {
+					Type:     schema.TypeList,
+					Required: true,
+					MinItems: 1,
+					Elem: &schema.Resource{
+						Schema: map[string]*schema.Schema{
+							"size": {
+								Type:         schema.TypeString,
+								Required:     false,
+								Optional:     true,
+								Default:      "",
+								ValidateFunc: validateDiskSize,
+							},
+							"mountpoint": {
+								Type:     schema.TypeString,
+								Required: true,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// parseDiskSize parses human-readable sizes like "100GB" or "1.5TiB", with
+// the empty size meaning the rest of the disk.
+func parseDiskSize(size string) (v1alpha1.DiskSize, error) {
+	if size == "" {
+		return 0, nil
+	}
+
+	bytes, err := humanize.ParseBytes(size)
+	if err != nil {
+		return 0, err
+	}
+
+	return v1alpha1.DiskSize(bytes), nil
+}
+
+func validateDiskSize(v interface{}, k string) ([]string, []error) {
+	if _, err := parseDiskSize(v.(string)); err != nil {
+		return nil, []error{fmt.Errorf("%q: %w", k, err)}
+	}
+
+	return nil, nil
+}
+
+// userDisk is v1alpha1.MachineDisk along with the declared device size.
+type userDisk struct {
+	machineDisk *v1alpha1.MachineDisk
+	size        v1alpha1.DiskSize
+}
+
+func expandDisks(disks []interface{}) ([]userDisk, error) {
+	var result []userDisk
+
+	for _, raw := range disks {
+		disk := raw.(map[string]interface{})
+
+		diskSize, err := parseDiskSize(disk["size"].(string))
+		if err != nil {
+			return nil, err
+		}
+
+		machineDisk := &v1alpha1.MachineDisk{
+			DeviceName: disk["device"].(string),
+		}
+
+		for _, raw := range disk["partition"].([]interface{}) {
+			partition := raw.(map[string]interface{})
+
+			size, err := parseDiskSize(partition["size"].(string))
+			if err != nil {
+				return nil, err
+			}
+
+			machineDisk.DiskPartitions = append(machineDisk.DiskPartitions, &v1alpha1.DiskPartition{
+				DiskSize:       size,
+				DiskMountPoint: partition["mountpoint"].(string),
+			})
+		}
+
+		result = append(result, userDisk{
+			machineDisk: machineDisk,
+			size:        diskSize,
+		})
+	}
+
+	return result, nil
+}
+
+func machineDisks(disks []userDisk) []*v1alpha1.MachineDisk {
+	result := make([]*v1alpha1.MachineDisk, 0, len(disks))
+
+	for _, disk := range disks {
+		result = append(result, disk.machineDisk)
+	}
+
+	return result
+}
+
+// validateDisks rejects partition layouts that can't be created: partitions
+// after one taking up the rest of the disk, partitions that don't fit the
+// declared disk size, mountpoints outside of /var, and disks or mountpoints
+// that overlap each other or the install disk.
+//
+//nolint:gocyclo
+func validateDisks(disks []userDisk, installDisk string) error {
+	var result *multierror.Error
+
+	devices := map[string]bool{}
+
+	var mountpoints []string
+
+	for _, disk := range disks {
+		device := disk.machineDisk.DeviceName
+
+		if !strings.HasPrefix(device, "/dev/") {
+			result = multierror.Append(result, fmt.Errorf("disk %q: device should be a path under /dev/", device))
+		}
+
+		if device == installDisk {
+			result = multierror.Append(result, fmt.Errorf("disk %q: device is the install disk", device))
+		}
+
+		if devices[device] {
+			result = multierror.Append(result, fmt.Errorf("disk %q: device is listed more than once", device))
+		}
+
+		devices[device] = true
+
+		var total uint64
+
+		partitions := disk.machineDisk.DiskPartitions
+
+		for j, partition := range partitions {
+			if partition.DiskSize == 0 && j != len(partitions)-1 {
+				result = multierror.Append(result, fmt.Errorf("disk %q: partition %d takes up the rest of the disk, but it's not the last partition", device, j))
+			}
+
+			total += uint64(partition.DiskSize)
+
+			mountpoint := partition.DiskMountPoint
+
+			if !path.IsAbs(mountpoint) {
+				result = multierror.Append(result, fmt.Errorf("disk %q: mountpoint %q should be an absolute path", device, mountpoint))
+
+				continue
+			}
+
+			// Talos only mounts user disks under /var.
+			if !strings.HasPrefix(path.Clean(mountpoint), "/var/") {
+				result = multierror.Append(result, fmt.Errorf("disk %q: mountpoint %q should be under /var", device, mountpoint))
+			}
+
+			for _, other := range mountpoints {
+				if pathsOverlap(mountpoint, other) {
+					result = multierror.Append(result, fmt.Errorf("disk %q: mountpoint %q overlaps with %q", device, mountpoint, other))
+				}
+			}
+
+			mountpoints = append(mountpoints, path.Clean(mountpoint))
+		}
+
+		if disk.size != 0 && total > uint64(disk.size) {
+			result = multierror.Append(result, fmt.Errorf("disk %q: partitions take up %s, which exceeds the disk size of %s", device, humanize.Bytes(total), humanize.Bytes(uint64(disk.size))))
+		}
+	}
+
+	return result.ErrorOrNil()
+}
+
+// pathsOverlap reports whether a and b are the same path or one is nested
+// in the other.
+func pathsOverlap(a, b string) bool {
+	a, b = path.Clean(a)+"/", path.Clean(b)+"/"
+
+	return strings.HasPrefix(a, b) || strings.HasPrefix(b, a)
+}
@@ -0,0 +1,179 @@
+package talos
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/talos-systems/talos/pkg/machinery/config"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1"
+	"github.com/talos-systems/talos/pkg/machinery/constants"
+)
+
+const encryptionProviderLUKS2 = "luks2"
+
+// encryptionCiphers are the ciphers the Talos luks2 provider accepts, the
+// empty one picking the default aes-xts-plain64.
+var encryptionCiphers = []string{
+	"",
+	"aes-xts-plain64",
+	"xchacha12,aes-adiantum-plain64",
+	"xchacha20,aes-adiantum-plain64",
+}
+
+func systemDiskEncryptionSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Required: false,
+		Optional: true,
+		MaxItems: 1,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"state":     encryptionConfigSchema(),
+				"ephemeral": encryptionConfigSchema(),
+			},
+		},
+	}
+}
+
+func encryptionConfigSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Required: false,
+		Optional: true,
+		MaxItems: 1,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"provider": {
+					Type:     schema.TypeString,
+					Required: false,
+					Optional: true,
+					Default:  encryptionProviderLUKS2,
+				},
+				"cipher": {
+					Type:     schema.TypeString,
+					Required: false,
+					Optional: true,
+					Default:  "",
+				},
+				"key": {
+					Type:     schema.TypeList,
+					Required: true,
+					MinItems: 1,
+					Elem: &schema.Resource{
+						Schema: map[string]*schema.Schema{
+							"slot": {
+								Type:     schema.TypeInt,
+								Required: true,
+							},
+							"static_passphrase": {
+								Type:      schema.TypeString,
+								Required:  false,
+								Optional:  true,
+								Default:   "",
+								Sensitive: true,
+							},
+							"node_id": {
+								Type:     schema.TypeBool,
+								Required: false,
+								Optional: true,
+								Default:  false,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func expandSystemDiskEncryption(systemDiskEncryption []interface{}) *v1alpha1.SystemDiskEncryptionConfig {
+	if len(systemDiskEncryption) == 0 || systemDiskEncryption[0] == nil {
+		return nil
+	}
+
+	partitions := systemDiskEncryption[0].(map[string]interface{})
+
+	return &v1alpha1.SystemDiskEncryptionConfig{
+		StatePartition:     expandEncryptionConfig(partitions["state"].([]interface{})),
+		EphemeralPartition: expandEncryptionConfig(partitions["ephemeral"].([]interface{})),
+	}
+}
+
+func expandEncryptionConfig(encryptionConfig []interface{}) *v1alpha1.EncryptionConfig {
+	if len(encryptionConfig) == 0 || encryptionConfig[0] == nil {
+		return nil
+	}
+
+	partition := encryptionConfig[0].(map[string]interface{})
+
+	result := &v1alpha1.EncryptionConfig{
+		EncryptionProvider: partition["provider"].(string),
+		EncryptionCipher:   partition["cipher"].(string),
+	}
+
+	for _, raw := range partition["key"].([]interface{}) {
+		key := raw.(map[string]interface{})
+
+		encryptionKey := &v1alpha1.EncryptionKey{
+			KeySlot: key["slot"].(int),
+		}
+
+		if passphrase := key["static_passphrase"].(string); passphrase != "" {
+			encryptionKey.KeyStatic = &v1alpha1.EncryptionKeyStatic{
+				KeyData: passphrase,
+			}
+		}
+
+		if key["node_id"].(bool) {
+			encryptionKey.KeyNodeID = &v1alpha1.EncryptionKeyNodeID{}
+		}
+
+		result.EncryptionKeys = append(result.EncryptionKeys, encryptionKey)
+	}
+
+	return result
+}
+
+func validateSystemDiskEncryption(cfg *v1alpha1.SystemDiskEncryptionConfig, contract *config.VersionContract) error {
+	if cfg == nil {
+		return nil
+	}
+
+	if !supportsSystemDiskEncryption(contract) {
+		return fmt.Errorf("system disk encryption requires Talos v0.10 or later")
+	}
+
+	var result *multierror.Error
+
+	for _, label := range []string{constants.StatePartitionLabel, constants.EphemeralPartitionLabel} {
+		encryptionConfig := cfg.Get(label)
+		if encryptionConfig == nil {
+			continue
+		}
+
+		if encryptionConfig.Kind() != encryptionProviderLUKS2 {
+			result = multierror.Append(result, fmt.Errorf("%s: unsupported encryption provider %q", label, encryptionConfig.Kind()))
+		}
+
+		if !stringInSlice(encryptionConfig.Cipher(), encryptionCiphers) {
+			result = multierror.Append(result, fmt.Errorf("%s: unsupported cipher %q", label, encryptionConfig.Cipher()))
+		}
+
+		slotsInUse := map[int]bool{}
+
+		for _, key := range encryptionConfig.Keys() {
+			if slotsInUse[key.Slot()] {
+				result = multierror.Append(result, fmt.Errorf("%s: encryption key slot %d is already in use", label, key.Slot()))
+			}
+
+			slotsInUse[key.Slot()] = true
+
+			if (key.Static() == nil) == (key.NodeID() == nil) {
+				result = multierror.Append(result, fmt.Errorf("%s: encryption key at slot %d should set exactly one of static_passphrase or node_id", label, key.Slot()))
+			}
+		}
+	}
+
+	return result.ErrorOrNil()
+}
@@ -0,0 +1,146 @@
+package talos
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1/machine"
+)
+
+// etcdAdvertiseArgs are the etcd flags set from advertised_subnets.
+var etcdAdvertiseArgs = []string{"advertise-client-urls", "initial-advertise-peer-urls"}
+
+// etcdConfig is v1alpha1.EtcdConfig along with the subnets etcd should
+// advertise on.
+type etcdConfig struct {
+	image             string
+	extraArgs         map[string]string
+	advertisedSubnets []string
+}
+
+func etcdSchema() *schema.Schema {
+	return componentSchema(nil)
+}
+
+// machineEtcdSchema is the etcd block of talos_machine_configuration, which
+// renders the config of a single node and so can pick the address etcd
+// advertises.
+func machineEtcdSchema() *schema.Schema {
+	return componentSchema(map[string]*schema.Schema{
+		"advertised_subnets": {
+			Type: schema.TypeList,
+			Elem: &schema.Schema{
+				Type:         schema.TypeString,
+				ValidateFunc: validateCIDR,
+			},
+			Required: false,
+			Optional: true,
+		},
+	})
+}
+
+func expandEtcdConfig(etcd []interface{}) *etcdConfig {
+	component := expandComponent(etcd)
+	if component == nil {
+		return nil
+	}
+
+	result := &etcdConfig{
+		image:     component["image"].(string),
+		extraArgs: expandStringMap(component["extra_args"].(map[string]interface{})),
+	}
+
+	if advertisedSubnets, ok := component["advertised_subnets"].([]interface{}); ok {
+		result.advertisedSubnets = expandStringList(advertisedSubnets)
+	}
+
+	return result
+}
+
+// validateEtcdConfig checks the subnets and that the extra args don't
+// override the flags managed by Talos or set from the subnets.
+func validateEtcdConfig(c *etcdConfig) error {
+	if c == nil {
+		return nil
+	}
+
+	result := multierror.Append(nil, validateManagedExtraArgs("etcd", c.extraArgs))
+
+	for _, subnet := range c.advertisedSubnets {
+		if _, _, err := net.ParseCIDR(subnet); err != nil {
+			result = multierror.Append(result, fmt.Errorf("etcd: advertised subnet %q is not a valid CIDR: %w", subnet, err))
+		}
+	}
+
+	if len(c.advertisedSubnets) > 0 {
+		for _, arg := range etcdAdvertiseArgs {
+			if _, ok := c.extraArgs[arg]; ok {
+				result = multierror.Append(result, fmt.Errorf("etcd: --%s is set from advertised_subnets", arg))
+			}
+		}
+	}
+
+	return result.ErrorOrNil()
+}
+
+// etcdAdvertiseAddress picks the first static address of the machine within
+// the subnets.
+func etcdAdvertiseAddress(cfg *v1alpha1.Config, subnets []string) (net.IP, error) {
+	addresses := staticAddresses(cfg)
+
+	for _, subnet := range subnets {
+		_, network, err := net.ParseCIDR(subnet)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ip := range addresses {
+			if network.Contains(ip) {
+				return ip, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("no static address in the advertised subnets %q, set the interface address with the network block", subnets)
+}
+
+// withEtcdConfig overrides the etcd image when set, adds the extra args and
+// points the advertised URLs at the address within advertised_subnets.
+func withEtcdConfig(c *etcdConfig) configOption {
+	return func(machineType machine.Type, cfg *v1alpha1.Config) error {
+		if c == nil || machineType == machine.TypeJoin {
+			return nil
+		}
+
+		if cfg.ClusterConfig.EtcdConfig == nil {
+			cfg.ClusterConfig.EtcdConfig = &v1alpha1.EtcdConfig{}
+		}
+
+		etcd := cfg.ClusterConfig.EtcdConfig
+
+		if c.image != "" {
+			etcd.ContainerImage = c.image
+		}
+
+		etcd.EtcdExtraArgs = mergeExtraArgs(etcd.EtcdExtraArgs, c.extraArgs)
+
+		if len(c.advertisedSubnets) == 0 {
+			return nil
+		}
+
+		ip, err := etcdAdvertiseAddress(cfg, c.advertisedSubnets)
+		if err != nil {
+			return fmt.Errorf("error configuring etcd for %s config: %w", machineType, err)
+		}
+
+		etcd.EtcdExtraArgs = mergeExtraArgs(etcd.EtcdExtraArgs, map[string]string{
+			"advertise-client-urls":       "https://" + net.JoinHostPort(ip.String(), "2379"),
+			"initial-advertise-peer-urls": "https://" + net.JoinHostPort(ip.String(), "2380"),
+		})
+
+		return nil
+	}
+}
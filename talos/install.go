@@ -0,0 +1,148 @@
+package talos
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1/machine"
+	"gopkg.in/yaml.v3"
+)
+
+func installDiskSelectorSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Required: false,
+		Optional: true,
+		MaxItems: 1,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"size": {
+					Type:         schema.TypeString,
+					Required:     false,
+					Optional:     true,
+					Default:      "",
+					ValidateFunc: validateInstallDiskSize,
+				},
+				"name": {
+					Type:     schema.TypeString,
+					Required: false,
+					Optional: true,
+					Default:  "",
+				},
+				"model": {
+					Type:     schema.TypeString,
+					Required: false,
+					Optional: true,
+					Default:  "",
+				},
+				"serial": {
+					Type:     schema.TypeString,
+					Required: false,
+					Optional: true,
+					Default:  "",
+				},
+				"modalias": {
+					Type:     schema.TypeString,
+					Required: false,
+					Optional: true,
+					Default:  "",
+				},
+				"uuid": {
+					Type:     schema.TypeString,
+					Required: false,
+					Optional: true,
+					Default:  "",
+				},
+				"wwid": {
+					Type:     schema.TypeString,
+					Required: false,
+					Optional: true,
+					Default:  "",
+				},
+				"type": {
+					Type:         schema.TypeString,
+					Required:     false,
+					Optional:     true,
+					Default:      "",
+					ValidateFunc: validateInstallDiskType,
+				},
+			},
+		},
+	}
+}
+
+// expandInstallDiskSelector goes through YAML, as the size matcher and the
+// disk type can only be built by their UnmarshalYAML. The argument names
+// match the v1alpha1.InstallDiskSelector keys.
+func expandInstallDiskSelector(selector []interface{}) (*v1alpha1.InstallDiskSelector, error) {
+	if len(selector) == 0 || selector[0] == nil {
+		return nil, nil
+	}
+
+	fields := map[string]string{}
+
+	for key, value := range selector[0].(map[string]interface{}) {
+		if value.(string) != "" {
+			fields[key] = value.(string)
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("install disk selector should match on at least one field")
+	}
+
+	marshaled, err := yaml.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &v1alpha1.InstallDiskSelector{}
+
+	if err = yaml.Unmarshal(marshaled, result); err != nil {
+		return nil, fmt.Errorf("error parsing install disk selector: %w", err)
+	}
+
+	return result, nil
+}
+
+func validateInstallDiskSize(v interface{}, k string) ([]string, []error) {
+	return validateYAMLUnmarshal(v.(string), k, &v1alpha1.InstallDiskSizeMatcher{})
+}
+
+func validateInstallDiskType(v interface{}, k string) ([]string, []error) {
+	return validateYAMLUnmarshal(v.(string), k, new(v1alpha1.InstallDiskType))
+}
+
+// validateYAMLUnmarshal checks that value parses as the YAML scalar of target.
+func validateYAMLUnmarshal(value, k string, target interface{}) ([]string, []error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	marshaled, err := yaml.Marshal(value)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	if err = yaml.Unmarshal(marshaled, target); err != nil {
+		return nil, []error{fmt.Errorf("%q: %w", k, err)}
+	}
+
+	return nil, nil
+}
+
+// withInstallDiskSelector sets the install disk selector, which takes the
+// place of the install disk.
+func withInstallDiskSelector(selector *v1alpha1.InstallDiskSelector) configOption {
+	return func(_ machine.Type, cfg *v1alpha1.Config) error {
+		if selector == nil {
+			return nil
+		}
+
+		cfg.MachineConfig.MachineInstall.InstallDisk = ""
+		cfg.MachineConfig.MachineInstall.InstallDiskSelector = selector
+
+		return nil
+	}
+}
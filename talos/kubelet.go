@@ -0,0 +1,315 @@
+package talos
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1/machine"
+)
+
+func kubeletSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Required: false,
+		Optional: true,
+		MaxItems: 1,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"image": {
+					Type:     schema.TypeString,
+					Required: false,
+					Optional: true,
+					Default:  "",
+				},
+				"extra_args": extraArgsSchema(),
+				"extra_mount": {
+					Type:     schema.TypeList,
+					Required: false,
+					Optional: true,
+					Elem: &schema.Resource{
+						Schema: map[string]*schema.Schema{
+							"source": {
+								Type:     schema.TypeString,
+								Required: true,
+							},
+							"destination": {
+								Type:     schema.TypeString,
+								Required: true,
+							},
+							"type": {
+								Type:     schema.TypeString,
+								Required: false,
+								Optional: true,
+								Default:  "bind",
+							},
+							"options": {
+								Type: schema.TypeList,
+								Elem: &schema.Schema{
+									Type: schema.TypeString,
+								},
+								Required: false,
+								Optional: true,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// machineKubeletSchema is the kubelet block of talos_machine_configuration,
+// which renders the config of a single node and so can pick its node IP.
+func machineKubeletSchema() *schema.Schema {
+	kubelet := kubeletSchema()
+
+	// node_ip_subnets picks the node IP among the static addresses of the
+	// node, one per IP family.
+	kubelet.Elem.(*schema.Resource).Schema["node_ip_subnets"] = &schema.Schema{
+		Type: schema.TypeList,
+		Elem: &schema.Schema{
+			Type:         schema.TypeString,
+			ValidateFunc: validateCIDR,
+		},
+		Required: false,
+		Optional: true,
+		MaxItems: 2,
+	}
+
+	return kubelet
+}
+
+// extraArgsSchema is the schema of the extraArgs of the Kubernetes components,
+// given without the leading dashes.
+func extraArgsSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:         schema.TypeMap,
+		Required:     false,
+		Optional:     true,
+		ValidateFunc: validateExtraArgs,
+		Elem: &schema.Schema{
+			Type: schema.TypeString,
+		},
+	}
+}
+
+func validateExtraArgs(v interface{}, k string) ([]string, []error) {
+	var errs []error
+
+	for key := range v.(map[string]interface{}) {
+		if key == "" || strings.HasPrefix(key, "-") || strings.ContainsAny(key, "= \t\n") {
+			errs = append(errs, fmt.Errorf("%q: %q should be a flag name without the leading dashes", k, key))
+		}
+	}
+
+	return nil, errs
+}
+
+// kubeletConfig is v1alpha1.KubeletConfig along with the subnets the node IP
+// is picked from.
+type kubeletConfig struct {
+	image         string
+	extraArgs     map[string]string
+	extraMounts   []specs.Mount
+	nodeIPSubnets []string
+}
+
+func expandKubeletConfig(kubelet []interface{}) *kubeletConfig {
+	if len(kubelet) == 0 || kubelet[0] == nil {
+		return nil
+	}
+
+	block := kubelet[0].(map[string]interface{})
+
+	result := &kubeletConfig{
+		image:     block["image"].(string),
+		extraArgs: expandStringMap(block["extra_args"].(map[string]interface{})),
+	}
+
+	if nodeIPSubnets, ok := block["node_ip_subnets"].([]interface{}); ok {
+		result.nodeIPSubnets = expandStringList(nodeIPSubnets)
+	}
+
+	for _, raw := range block["extra_mount"].([]interface{}) {
+		mount := raw.(map[string]interface{})
+
+		result.extraMounts = append(result.extraMounts, specs.Mount{
+			Source:      mount["source"].(string),
+			Destination: mount["destination"].(string),
+			Type:        mount["type"].(string),
+			Options:     expandStringList(mount["options"].([]interface{})),
+		})
+	}
+
+	return result
+}
+
+// validateKubeletConfig checks the node IP subnets and the extra mounts: paths
+// should be absolute, destinations unique, and bind mounts should have a bind
+// or rbind option as the container runtime won't bind mount otherwise.
+func validateKubeletConfig(c *kubeletConfig) error {
+	if c == nil {
+		return nil
+	}
+
+	var result *multierror.Error
+
+	if len(c.nodeIPSubnets) > 0 {
+		if _, err := clusterSubnetFamilies("node_ip_subnets", c.nodeIPSubnets); err != nil {
+			result = multierror.Append(result, err)
+		}
+
+		if _, ok := c.extraArgs["node-ip"]; ok {
+			result = multierror.Append(result, fmt.Errorf("--node-ip is set from node_ip_subnets"))
+		}
+	}
+
+	destinations := map[string]bool{}
+
+	for _, mount := range c.extraMounts {
+		if !path.IsAbs(mount.Destination) {
+			result = multierror.Append(result, fmt.Errorf("extra mount %q: destination should be an absolute path", mount.Destination))
+		}
+
+		if destinations[path.Clean(mount.Destination)] {
+			result = multierror.Append(result, fmt.Errorf("extra mount %q: destination is mounted more than once", mount.Destination))
+		}
+
+		destinations[path.Clean(mount.Destination)] = true
+
+		if mount.Type != "bind" {
+			continue
+		}
+
+		if !path.IsAbs(mount.Source) {
+			result = multierror.Append(result, fmt.Errorf("extra mount %q: bind mount source %q should be an absolute path", mount.Destination, mount.Source))
+		}
+
+		if !stringInSlice("bind", mount.Options) && !stringInSlice("rbind", mount.Options) {
+			result = multierror.Append(result, fmt.Errorf("extra mount %q: bind mount options should include bind or rbind", mount.Destination))
+		}
+	}
+
+	return result.ErrorOrNil()
+}
+
+// validateClusterKubeletConfigs validates the kubelet blocks of
+// talos_cluster_config, where the role blocks are applied on top of the one
+// for all roles.
+func validateClusterKubeletConfigs(all, controlPlane, join *kubeletConfig) error {
+	var result *multierror.Error
+
+	for _, block := range []struct {
+		name string
+		c    *kubeletConfig
+	}{
+		{"kubelet", all},
+		{"kubelet_control_plane", controlPlane},
+		{"kubelet_join", join},
+	} {
+		if block.c == nil {
+			continue
+		}
+
+		if err := validateKubeletConfig(block.c); err != nil {
+			result = multierror.Append(result, fmt.Errorf("%s: %w", block.name, err))
+		}
+
+		if all == nil || block.c == all {
+			continue
+		}
+
+		for _, mount := range block.c.extraMounts {
+			for _, other := range all.extraMounts {
+				if path.Clean(mount.Destination) == path.Clean(other.Destination) {
+					result = multierror.Append(result, fmt.Errorf("%s: extra mount %q is already mounted by the kubelet block", block.name, mount.Destination))
+				}
+			}
+		}
+	}
+
+	return result.ErrorOrNil()
+}
+
+// kubeletNodeIPs picks the first static address of the machine within each
+// of the subnets.
+func kubeletNodeIPs(cfg *v1alpha1.Config, subnets []string) ([]string, error) {
+	addresses := staticAddresses(cfg)
+
+	result := make([]string, 0, len(subnets))
+
+	for _, subnet := range subnets {
+		_, network, err := net.ParseCIDR(subnet)
+		if err != nil {
+			return nil, err
+		}
+
+		var nodeIP net.IP
+
+		for _, ip := range addresses {
+			if network.Contains(ip) {
+				nodeIP = ip
+
+				break
+			}
+		}
+
+		if nodeIP == nil {
+			return nil, fmt.Errorf("no static address in the node IP subnet %s, set the interface address with the network block", subnet)
+		}
+
+		result = append(result, nodeIP.String())
+	}
+
+	return result, nil
+}
+
+// withKubeletConfig overrides the kubelet image when set, adds the extra args
+// and mounts, and sets the node IP from the node IP subnets for the selected
+// machine roles.
+func withKubeletConfig(c *kubeletConfig, patchControlPlane, patchJoin bool) configOption {
+	return func(machineType machine.Type, cfg *v1alpha1.Config) error {
+		if c == nil {
+			return nil
+		}
+
+		if machineType == machine.TypeJoin && !patchJoin || machineType != machine.TypeJoin && !patchControlPlane {
+			return nil
+		}
+
+		if cfg.MachineConfig.MachineKubelet == nil {
+			cfg.MachineConfig.MachineKubelet = &v1alpha1.KubeletConfig{}
+		}
+
+		kubelet := cfg.MachineConfig.MachineKubelet
+
+		if c.image != "" {
+			kubelet.KubeletImage = c.image
+		}
+
+		kubelet.KubeletExtraArgs = mergeExtraArgs(kubelet.KubeletExtraArgs, c.extraArgs)
+
+		kubelet.KubeletExtraMounts = append(kubelet.KubeletExtraMounts, c.extraMounts...)
+
+		if len(c.nodeIPSubnets) == 0 {
+			return nil
+		}
+
+		nodeIPs, err := kubeletNodeIPs(cfg, c.nodeIPSubnets)
+		if err != nil {
+			return fmt.Errorf("error configuring the kubelet for %s config: %w", machineType, err)
+		}
+
+		kubelet.KubeletExtraArgs = mergeExtraArgs(kubelet.KubeletExtraArgs, map[string]string{
+			"node-ip": strings.Join(nodeIPs, ","),
+		})
+
+		return nil
+	}
+}
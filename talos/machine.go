@@ -0,0 +1,224 @@
+package talos
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1/machine"
+)
+
+var (
+	fileOps = []string{"create", "append", "overwrite"}
+
+	// machineEnvKeys are the environment variables Talos accepts.
+	machineEnvKeys = []string{
+		"GRPC_GO_LOG_VERBOSITY_LEVEL",
+		"GRPC_GO_LOG_SEVERITY_LEVEL",
+		"http_proxy",
+		"https_proxy",
+		"no_proxy",
+	}
+)
+
+func filesSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Required: false,
+		Optional: true,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"content": {
+					Type:     schema.TypeString,
+					Required: true,
+				},
+				"path": {
+					Type:     schema.TypeString,
+					Required: true,
+				},
+				"permissions": {
+					Type:         schema.TypeString,
+					Required:     false,
+					Optional:     true,
+					Default:      "0644",
+					ValidateFunc: validateFileMode,
+				},
+				"op": {
+					Type:         schema.TypeString,
+					Required:     false,
+					Optional:     true,
+					Default:      "create",
+					ValidateFunc: validateFileOp,
+				},
+			},
+		},
+	}
+}
+
+func sysctlsSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:         schema.TypeMap,
+		Required:     false,
+		Optional:     true,
+		ValidateFunc: validateSysctls,
+		Elem: &schema.Schema{
+			Type: schema.TypeString,
+		},
+	}
+}
+
+func envSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:         schema.TypeMap,
+		Required:     false,
+		Optional:     true,
+		ValidateFunc: validateMachineEnv,
+		Elem: &schema.Schema{
+			Type: schema.TypeString,
+		},
+	}
+}
+
+func parseFileMode(permissions string) (v1alpha1.FileMode, error) {
+	mode, err := strconv.ParseUint(permissions, 8, 32)
+	if err != nil || mode > 0o7777 {
+		return 0, fmt.Errorf("%q is not an octal file mode", permissions)
+	}
+
+	return v1alpha1.FileMode(mode), nil
+}
+
+func validateFileMode(v interface{}, k string) ([]string, []error) {
+	if _, err := parseFileMode(v.(string)); err != nil {
+		return nil, []error{fmt.Errorf("%q: %w", k, err)}
+	}
+
+	return nil, nil
+}
+
+func validateFileOp(v interface{}, k string) ([]string, []error) {
+	if !stringInSlice(v.(string), fileOps) {
+		return nil, []error{fmt.Errorf("%q: file op should be one of %q", k, fileOps)}
+	}
+
+	return nil, nil
+}
+
+func validateSysctls(v interface{}, k string) ([]string, []error) {
+	var errs []error
+
+	for key := range v.(map[string]interface{}) {
+		if key == "" || strings.ContainsAny(key, "= \t\n") {
+			errs = append(errs, fmt.Errorf("%q: %q is not a valid sysctl name", k, key))
+		}
+	}
+
+	return nil, errs
+}
+
+func validateMachineEnv(v interface{}, k string) ([]string, []error) {
+	var errs []error
+
+	for key := range v.(map[string]interface{}) {
+		if !stringInSlice(key, machineEnvKeys) {
+			errs = append(errs, fmt.Errorf("%q: environment variable %q isn't supported, should be one of %q", k, key, machineEnvKeys))
+		}
+	}
+
+	return nil, errs
+}
+
+func expandFiles(files []interface{}) ([]*v1alpha1.MachineFile, error) {
+	result := make([]*v1alpha1.MachineFile, 0, len(files))
+
+	for _, file := range files {
+		file := file.(map[string]interface{})
+
+		permissions, err := parseFileMode(file["permissions"].(string))
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, &v1alpha1.MachineFile{
+			FileContent:     file["content"].(string),
+			FilePermissions: permissions,
+			FilePath:        file["path"].(string),
+			FileOp:          file["op"].(string),
+		})
+	}
+
+	return result, nil
+}
+
+// validateFiles checks that file paths are absolute and unique, and that new
+// files are only created under /var, the only writable location.
+func validateFiles(files []*v1alpha1.MachineFile) error {
+	var result *multierror.Error
+
+	paths := map[string]struct{}{}
+
+	for _, file := range files {
+		if !path.IsAbs(file.FilePath) {
+			result = multierror.Append(result, fmt.Errorf("file path %q should be absolute", file.FilePath))
+
+			continue
+		}
+
+		filePath := path.Clean(file.FilePath)
+
+		if _, ok := paths[filePath]; ok {
+			result = multierror.Append(result, fmt.Errorf("file path %q is duplicate", file.FilePath))
+		}
+
+		paths[filePath] = struct{}{}
+
+		if file.FileOp == "create" && !strings.HasPrefix(filePath+"/", "/var/") {
+			result = multierror.Append(result, fmt.Errorf("file %q can only be created under /var", file.FilePath))
+		}
+	}
+
+	return result.ErrorOrNil()
+}
+
+func expandStringMap(m map[string]interface{}) map[string]string {
+	result := make(map[string]string, len(m))
+
+	for key, value := range m {
+		result[key] = value.(string)
+	}
+
+	return result
+}
+
+// withMachineFiles adds the files, sysctls and environment variables.
+func withMachineFiles(files []*v1alpha1.MachineFile, sysctls, env map[string]string) configOption {
+	return func(_ machine.Type, cfg *v1alpha1.Config) error {
+		cfg.MachineConfig.MachineFiles = append(cfg.MachineConfig.MachineFiles, files...)
+
+		if len(sysctls) > 0 {
+			if cfg.MachineConfig.MachineSysctls == nil {
+				cfg.MachineConfig.MachineSysctls = map[string]string{}
+			}
+
+			for key, value := range sysctls {
+				cfg.MachineConfig.MachineSysctls[key] = value
+			}
+		}
+
+		if len(env) > 0 {
+			if cfg.MachineConfig.MachineEnv == nil {
+				cfg.MachineConfig.MachineEnv = v1alpha1.Env{}
+			}
+
+			for key, value := range env {
+				cfg.MachineConfig.MachineEnv[key] = value
+			}
+		}
+
+		return nil
+	}
+}
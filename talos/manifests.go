@@ -0,0 +1,89 @@
+package talos
+
+import (
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1/machine"
+)
+
+func inlineManifestSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Required: false,
+		Optional: true,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"name": {
+					Type:     schema.TypeString,
+					Required: true,
+				},
+				"contents": {
+					Type:     schema.TypeString,
+					Required: true,
+				},
+			},
+		},
+	}
+}
+
+func extraManifestsSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Required: false,
+		Optional: true,
+		Elem: &schema.Schema{
+			Type:         schema.TypeString,
+			ValidateFunc: validateURL,
+		},
+	}
+}
+
+func extraManifestHeadersSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeMap,
+		Required: false,
+		Optional: true,
+		Elem: &schema.Schema{
+			Type: schema.TypeString,
+		},
+	}
+}
+
+func expandInlineManifests(manifests []interface{}) v1alpha1.ClusterInlineManifests {
+	result := v1alpha1.ClusterInlineManifests{}
+
+	for _, manifest := range manifests {
+		manifest := manifest.(map[string]interface{})
+
+		result = append(result, v1alpha1.ClusterInlineManifest{
+			InlineManifestName:     manifest["name"].(string),
+			InlineManifestContents: manifest["contents"].(string),
+		})
+	}
+
+	return result
+}
+
+// withClusterManifests adds the bootstrap manifests, which only the control
+// plane applies.
+func withClusterManifests(inlineManifests v1alpha1.ClusterInlineManifests, extraManifests []string, extraManifestHeaders map[string]string) configOption {
+	return func(machineType machine.Type, cfg *v1alpha1.Config) error {
+		if machineType == machine.TypeJoin {
+			return nil
+		}
+
+		if len(inlineManifests) > 0 {
+			cfg.ClusterConfig.ClusterInlineManifests = inlineManifests
+		}
+
+		if len(extraManifests) > 0 {
+			cfg.ClusterConfig.ExtraManifests = extraManifests
+		}
+
+		if len(extraManifestHeaders) > 0 {
+			cfg.ClusterConfig.ExtraManifestHeaders = extraManifestHeaders
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,250 @@
+package talos
+
+import (
+	"net"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1/machine"
+)
+
+func networkSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Required: false,
+		Optional: true,
+		MaxItems: 1,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"nameservers": {
+					Type: schema.TypeList,
+					Elem: &schema.Schema{
+						Type:         schema.TypeString,
+						ValidateFunc: validateIP,
+					},
+					Required: false,
+					Optional: true,
+				},
+				"interface": {
+					Type:     schema.TypeList,
+					Required: false,
+					Optional: true,
+					Elem: &schema.Resource{
+						Schema: map[string]*schema.Schema{
+							"name": {
+								Type:     schema.TypeString,
+								Required: true,
+							},
+							"ignore": {
+								Type:     schema.TypeBool,
+								Required: false,
+								Optional: true,
+								Default:  false,
+							},
+							"dhcp": {
+								Type:     schema.TypeBool,
+								Required: false,
+								Optional: true,
+								Default:  false,
+							},
+							"dhcp_v4": {
+								Type:     schema.TypeBool,
+								Required: false,
+								Optional: true,
+								Default:  true,
+							},
+							"dhcp_v6": {
+								Type:     schema.TypeBool,
+								Required: false,
+								Optional: true,
+								Default:  false,
+							},
+							"cidr": {
+								Type:         schema.TypeString,
+								Required:     false,
+								Optional:     true,
+								Default:      "",
+								ValidateFunc: validateCIDR,
+							},
+							"gateway": {
+								Type:         schema.TypeString,
+								Required:     false,
+								Optional:     true,
+								Default:      "",
+								ValidateFunc: validateIP,
+							},
+							"mtu": {
+								Type:     schema.TypeInt,
+								Required: false,
+								Optional: true,
+								Default:  0,
+							},
+							"vip": {
+								Type:         schema.TypeString,
+								Required:     false,
+								Optional:     true,
+								Default:      "",
+								ValidateFunc: validateIP,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func expandNetworkOptions(network []interface{}) []v1alpha1.NetworkConfigOption {
+	var options []v1alpha1.NetworkConfigOption
+
+	if len(network) == 0 || network[0] == nil {
+		return options
+	}
+
+	networkConfig := network[0].(map[string]interface{})
+
+	var nameservers []string
+
+	for _, nameserver := range networkConfig["nameservers"].([]interface{}) {
+		nameservers = append(nameservers, nameserver.(string))
+	}
+
+	if len(nameservers) > 0 {
+		options = append(options, v1alpha1.WithNetworkNameservers(nameservers...))
+	}
+
+	for _, raw := range networkConfig["interface"].([]interface{}) {
+		iface := raw.(map[string]interface{})
+		name := iface["name"].(string)
+
+		if iface["ignore"].(bool) {
+			options = append(options, v1alpha1.WithNetworkInterfaceIgnore(name))
+		}
+
+		// DHCPv4 is on and DHCPv6 is off unless set otherwise, so only the
+		// overrides end up in the config.
+		if iface["dhcp"].(bool) {
+			options = append(options, v1alpha1.WithNetworkInterfaceDHCP(name, true))
+
+			if !iface["dhcp_v4"].(bool) {
+				options = append(options, v1alpha1.WithNetworkInterfaceDHCPv4(name, false))
+			}
+
+			if iface["dhcp_v6"].(bool) {
+				options = append(options, v1alpha1.WithNetworkInterfaceDHCPv6(name, true))
+			}
+		}
+
+		if cidr := iface["cidr"].(string); cidr != "" {
+			options = append(options, v1alpha1.WithNetworkInterfaceCIDR(name, cidr))
+		}
+
+		if gateway := iface["gateway"].(string); gateway != "" {
+			options = append(options, withNetworkInterfaceDefaultRoute(name, gateway))
+		}
+
+		if mtu := iface["mtu"].(int); mtu != 0 {
+			options = append(options, v1alpha1.WithNetworkInterfaceMTU(name, mtu))
+		}
+
+		if vip := iface["vip"].(string); vip != "" {
+			options = append(options, v1alpha1.WithNetworkInterfaceVirtualIP(name, vip))
+		}
+	}
+
+	return options
+}
+
+// validateNetworkOptions runs the device checks Talos runs on boot against the
+// network config the options generate.
+func validateNetworkOptions(options []v1alpha1.NetworkConfigOption) error {
+	var result *multierror.Error
+
+	networkConfig := &v1alpha1.NetworkConfig{}
+
+	for _, opt := range options {
+		if err := opt(machine.TypeControlPlane, networkConfig); err != nil {
+			return err
+		}
+	}
+
+	for _, device := range networkConfig.NetworkInterfaces {
+		result = multierror.Append(result, v1alpha1.ValidateNetworkDevices(device,
+			v1alpha1.CheckDeviceInterface,
+			v1alpha1.CheckDeviceAddressing,
+			v1alpha1.CheckDeviceRoutes,
+		))
+	}
+
+	return result.ErrorOrNil()
+}
+
+func withNetworkHostname(hostname string) v1alpha1.NetworkConfigOption {
+	return func(_ machine.Type, cfg *v1alpha1.NetworkConfig) error {
+		cfg.NetworkHostname = hostname
+
+		return nil
+	}
+}
+
+func withNetworkInterfaceDefaultRoute(iface, gateway string) v1alpha1.NetworkConfigOption {
+	return func(_ machine.Type, cfg *v1alpha1.NetworkConfig) error {
+		network := "0.0.0.0/0"
+		if net.ParseIP(gateway).To4() == nil {
+			network = "::/0"
+		}
+
+		dev := networkDevice(cfg, iface)
+		dev.DeviceRoutes = append(dev.DeviceRoutes, &v1alpha1.Route{
+			RouteNetwork: network,
+			RouteGateway: gateway,
+		})
+
+		return nil
+	}
+}
+
+// networkDevice finds or adds the interface the same way the v1alpha1
+// network options do.
+func networkDevice(cfg *v1alpha1.NetworkConfig, iface string) *v1alpha1.Device {
+	for _, dev := range cfg.NetworkInterfaces {
+		if dev.DeviceInterface == iface {
+			return dev
+		}
+	}
+
+	dev := &v1alpha1.Device{
+		DeviceInterface: iface,
+	}
+
+	cfg.NetworkInterfaces = append(cfg.NetworkInterfaces, dev)
+
+	return dev
+}
+
+// staticAddresses returns the interface and VLAN addresses set in the machine
+// config.
+func staticAddresses(cfg *v1alpha1.Config) []net.IP {
+	var result []net.IP
+
+	if cfg.MachineConfig.MachineNetwork == nil {
+		return nil
+	}
+
+	for _, device := range cfg.MachineConfig.MachineNetwork.NetworkInterfaces {
+		cidrs := []string{device.DeviceCIDR}
+
+		for _, vlan := range device.DeviceVlans {
+			cidrs = append(cidrs, vlan.VlanCIDR)
+		}
+
+		for _, cidr := range cidrs {
+			if ip, _, err := net.ParseCIDR(cidr); err == nil {
+				result = append(result, ip)
+			}
+		}
+	}
+
+	return result
+}
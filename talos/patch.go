@@ -0,0 +1,229 @@
+package talos
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1/machine"
+	"gopkg.in/yaml.v3"
+)
+
+// mergePatchListKeys are the lists merged element by element on the given key
+// instead of being replaced as a whole.
+var mergePatchListKeys = map[string]string{
+	"machine.network.interfaces": "interface",
+	"machine.disks":              "device",
+	"machine.files":              "path",
+}
+
+// jsonPatch is a JSON patch argument along with the machine roles it applies
+// to. The name is used for errors.
+type jsonPatch struct {
+	name              string
+	patch             string
+	patchControlPlane bool
+	patchJoin         bool
+}
+
+// applyJSONPatch applies the patch one operation at a time, so that a failure
+// can be pinned to the operation.
+func applyJSONPatch(configBundle *v1alpha1.ConfigBundle, patch jsonPatch) error {
+	if patch.patch == "" {
+		return nil
+	}
+
+	decoded, err := jsonpatch.DecodePatch([]byte(patch.patch))
+	if err != nil {
+		return fmt.Errorf("error parsing %s: %w", patch.name, err)
+	}
+
+	for i, operation := range decoded {
+		if err = configBundle.ApplyJSONPatch(jsonpatch.Patch{operation}, patch.patchControlPlane, patch.patchJoin); err != nil {
+			path, _ := operation.Path() //nolint:errcheck
+
+			return fmt.Errorf("error applying %s: operation %d (%s %s): %w", patch.name, i, operation.Kind(), path, err)
+		}
+	}
+
+	return nil
+}
+
+func validateJSONPatch(v interface{}, k string) ([]string, []error) {
+	value := v.(string)
+	if value == "" {
+		return nil, nil
+	}
+
+	if _, err := jsonpatch.DecodePatch([]byte(value)); err != nil {
+		return nil, []error{fmt.Errorf("%q: invalid JSON patch: %w", k, err)}
+	}
+
+	return nil, nil
+}
+
+// validateMergePatch checks that the patch is a partial v1alpha1 config.
+func validateMergePatch(v interface{}, k string) ([]string, []error) {
+	value := v.(string)
+	if value == "" {
+		return nil, nil
+	}
+
+	if err := decodeConfig([]byte(value), &v1alpha1.Config{}); err != nil {
+		return nil, []error{fmt.Errorf("%q: invalid merge patch: %w", k, err)}
+	}
+
+	return nil, nil
+}
+
+// withMergePatch deep merges a partial v1alpha1 config into the generated
+// configs of the selected machine roles.
+func withMergePatch(patch string, patchControlPlane, patchJoin bool) configOption {
+	return func(machineType machine.Type, cfg *v1alpha1.Config) error {
+		if patch == "" {
+			return nil
+		}
+
+		if machineType == machine.TypeJoin && !patchJoin || machineType != machine.TypeJoin && !patchControlPlane {
+			return nil
+		}
+
+		patched, err := applyMergePatch(cfg, []byte(patch))
+		if err != nil {
+			return fmt.Errorf("error applying merge patch to %s config: %w", machineType, err)
+		}
+
+		*cfg = *patched
+
+		return nil
+	}
+}
+
+func applyMergePatch(cfg *v1alpha1.Config, patch []byte) (*v1alpha1.Config, error) {
+	marshaled, err := cfg.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	var original, patchValue interface{}
+
+	if err = yaml.Unmarshal(marshaled, &original); err != nil {
+		return nil, err
+	}
+
+	if err = yaml.Unmarshal(patch, &patchValue); err != nil {
+		return nil, err
+	}
+
+	if _, ok := patchValue.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("merge patch should be a YAML map")
+	}
+
+	merged, err := mergeValues(nil, original, patchValue)
+	if err != nil {
+		return nil, err
+	}
+
+	if marshaled, err = yaml.Marshal(merged); err != nil {
+		return nil, err
+	}
+
+	result := &v1alpha1.Config{}
+
+	if err = decodeConfig(marshaled, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// mergeValues merges patch into original: maps are merged key by key, a null
+// removes the key, keyed lists are merged element by element and everything
+// else is replaced.
+func mergeValues(path []string, original, patch interface{}) (interface{}, error) {
+	switch patch := patch.(type) {
+	case map[string]interface{}:
+		originalMap, ok := original.(map[string]interface{})
+		if !ok {
+			if original != nil {
+				return nil, fmt.Errorf("%s: can't merge a map into %T", strings.Join(path, "."), original)
+			}
+
+			originalMap = map[string]interface{}{}
+		}
+
+		for key, value := range patch {
+			if value == nil {
+				delete(originalMap, key)
+
+				continue
+			}
+
+			merged, err := mergeValues(append(path, key), originalMap[key], value)
+			if err != nil {
+				return nil, err
+			}
+
+			originalMap[key] = merged
+		}
+
+		return originalMap, nil
+	case []interface{}:
+		listKey, ok := mergePatchListKeys[strings.Join(path, ".")]
+		if !ok {
+			return patch, nil
+		}
+
+		originalList, _ := original.([]interface{})
+
+		return mergeKeyedLists(path, listKey, originalList, patch)
+	default:
+		return patch, nil
+	}
+}
+
+func mergeKeyedLists(path []string, listKey string, original, patch []interface{}) ([]interface{}, error) {
+	for i, item := range patch {
+		itemMap, ok := item.(map[string]interface{})
+		if ok {
+			_, ok = itemMap[listKey].(string)
+		}
+
+		if !ok {
+			return nil, fmt.Errorf("%s[%d]: list items should be maps with a %q key", strings.Join(path, "."), i, listKey)
+		}
+
+		found := false
+
+		for j, originalItem := range original {
+			if originalItemMap, ok := originalItem.(map[string]interface{}); ok && originalItemMap[listKey] == itemMap[listKey] {
+				merged, err := mergeValues(path, originalItemMap, itemMap)
+				if err != nil {
+					return nil, err
+				}
+
+				original[j] = merged
+				found = true
+
+				break
+			}
+		}
+
+		if !found {
+			original = append(original, itemMap)
+		}
+	}
+
+	return original, nil
+}
+
+// decodeConfig is yaml.Unmarshal rejecting unknown fields, so that typos in
+// patches don't go unnoticed.
+func decodeConfig(in []byte, cfg *v1alpha1.Config) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(in))
+	decoder.KnownFields(true)
+
+	return decoder.Decode(cfg)
+}
@@ -7,7 +7,12 @@ import (
 func Provider() *schema.Provider {
 	return &schema.Provider{
 		ResourcesMap: map[string]*schema.Resource{
-			"talos_cluster_config": resourceTalosClusterConfig(),
+			"talos_cluster_config":  resourceTalosClusterConfig(),
+			"talos_machine_secrets": resourceTalosMachineSecrets(),
+			"talos_wireguard_mesh":  resourceTalosWireguardMesh(),
+		},
+		DataSourcesMap: map[string]*schema.Resource{
+			"talos_machine_configuration": dataSourceTalosMachineConfiguration(),
 		},
 	}
 }
@@ -0,0 +1,158 @@
+package talos
+
+import (
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1/generate"
+)
+
+func registriesSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Required: false,
+		Optional: true,
+		MaxItems: 1,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"mirror": {
+					Type:     schema.TypeList,
+					Required: false,
+					Optional: true,
+					Elem: &schema.Resource{
+						Schema: map[string]*schema.Schema{
+							"host": {
+								Type:     schema.TypeString,
+								Required: true,
+							},
+							"endpoints": {
+								Type: schema.TypeList,
+								Elem: &schema.Schema{
+									Type: schema.TypeString,
+								},
+								Required: true,
+								MinItems: 1,
+							},
+						},
+					},
+				},
+				"config": {
+					Type:     schema.TypeList,
+					Required: false,
+					Optional: true,
+					Elem: &schema.Resource{
+						Schema: map[string]*schema.Schema{
+							"host": {
+								Type:     schema.TypeString,
+								Required: true,
+							},
+							"ca_cert": {
+								Type:     schema.TypeString,
+								Required: false,
+								Optional: true,
+								Default:  "",
+							},
+							"insecure_skip_verify": {
+								Type:     schema.TypeBool,
+								Required: false,
+								Optional: true,
+								Default:  false,
+							},
+							"username": {
+								Type:     schema.TypeString,
+								Required: false,
+								Optional: true,
+								Default:  "",
+							},
+							"password": {
+								Type:      schema.TypeString,
+								Required:  false,
+								Optional:  true,
+								Default:   "",
+								Sensitive: true,
+							},
+							"auth": {
+								Type:      schema.TypeString,
+								Required:  false,
+								Optional:  true,
+								Default:   "",
+								Sensitive: true,
+							},
+							"identity_token": {
+								Type:      schema.TypeString,
+								Required:  false,
+								Optional:  true,
+								Default:   "",
+								Sensitive: true,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func expandRegistriesOptions(registries []interface{}) []generate.GenOption {
+	var options []generate.GenOption
+
+	if len(registries) == 0 || registries[0] == nil {
+		return options
+	}
+
+	registriesConfig := registries[0].(map[string]interface{})
+
+	for _, raw := range registriesConfig["mirror"].([]interface{}) {
+		mirror := raw.(map[string]interface{})
+
+		var endpoints []string
+
+		for _, endpoint := range mirror["endpoints"].([]interface{}) {
+			endpoints = append(endpoints, endpoint.(string))
+		}
+
+		options = append(options, generate.WithRegistryMirror(mirror["host"].(string), endpoints...))
+	}
+
+	for _, raw := range registriesConfig["config"].([]interface{}) {
+		config := raw.(map[string]interface{})
+		host := config["host"].(string)
+
+		if caCert := config["ca_cert"].(string); caCert != "" {
+			options = append(options, generate.WithRegistryCACert(host, caCert))
+		}
+
+		if config["insecure_skip_verify"].(bool) {
+			options = append(options, generate.WithRegistryInsecureSkipVerify(host))
+		}
+
+		auth := &v1alpha1.RegistryAuthConfig{
+			RegistryUsername:      config["username"].(string),
+			RegistryPassword:      config["password"].(string),
+			RegistryAuth:          config["auth"].(string),
+			RegistryIdentityToken: config["identity_token"].(string),
+		}
+
+		if *auth != (v1alpha1.RegistryAuthConfig{}) {
+			options = append(options, withRegistryAuth(host, auth))
+		}
+	}
+
+	return options
+}
+
+// withRegistryAuth is the missing generate option for registry credentials.
+func withRegistryAuth(host string, auth *v1alpha1.RegistryAuthConfig) generate.GenOption {
+	return func(o *generate.GenOptions) error {
+		if o.RegistryConfig == nil {
+			o.RegistryConfig = make(map[string]*v1alpha1.RegistryConfig)
+		}
+
+		if _, ok := o.RegistryConfig[host]; !ok {
+			o.RegistryConfig[host] = &v1alpha1.RegistryConfig{}
+		}
+
+		o.RegistryConfig[host].RegistryAuth = auth
+
+		return nil
+	}
+}
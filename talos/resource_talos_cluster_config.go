@@ -1,19 +1,36 @@
 package talos
 
 import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
-	"github.com/talos-systems/talos/cmd/talosctl/cmd/mgmt"
-	"github.com/talos-systems/talos/pkg/machinery/config"
+	clientconfig "github.com/talos-systems/talos/pkg/machinery/client/config"
+	"github.com/talos-systems/talos/pkg/machinery/config/configloader"
 	"github.com/talos-systems/talos/pkg/machinery/config/encoder"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1"
 	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1/generate"
 	"gopkg.in/yaml.v3"
 )
 
 func resourceTalosClusterConfig() *schema.Resource {
 	return &schema.Resource{
-		Create: resourceTalosClusterConfigCreate,
-		Read:   resourceTalosClusterConfigRead,
-		Delete: resourceTalosClusterConfigDelete,
+		CreateContext: resourceTalosClusterConfigCreate,
+		ReadContext:   resourceTalosClusterConfigRead,
+		UpdateContext: resourceTalosClusterConfigUpdate,
+		DeleteContext: resourceTalosClusterConfigDelete,
+
+		CustomizeDiff: resourceTalosClusterConfigCustomizeDiff,
+
+		Importer: &schema.ResourceImporter{
+			State: resourceTalosClusterConfigImport,
+		},
 
 		Schema: map[string]*schema.Schema{
 			"cluster_name": {
@@ -22,9 +39,9 @@ func resourceTalosClusterConfig() *schema.Resource {
 				ForceNew: true,
 			},
 			"endpoint": {
-				Type:     schema.TypeString,
-				Required: true,
-				ForceNew: true,
+				Type:         schema.TypeString,
+				Required:     true,
+				ValidateFunc: validateEndpoint,
 			},
 			"additional_sans": {
 				Type: schema.TypeList,
@@ -33,75 +50,180 @@ func resourceTalosClusterConfig() *schema.Resource {
 				},
 				Required: false,
 				Optional: true,
-				ForceNew: true,
 			},
 			"dns_domain": {
 				Type:     schema.TypeString,
 				Required: false,
 				Optional: true,
 				Default:  "cluster.local",
-				ForceNew: true,
+			},
+			"pod_subnets":     clusterSubnetsSchema(),
+			"service_subnets": clusterSubnetsSchema(),
+			"talos_endpoints": {
+				Type:     schema.TypeList,
+				Required: false,
+				Optional: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"talos_nodes": {
+				Type:     schema.TypeList,
+				Required: false,
+				Optional: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
 			},
 			"install_disk": {
 				Type:     schema.TypeString,
 				Required: false,
 				Optional: true,
 				Default:  "/dev/sda",
-				ForceNew: true,
+			},
+			"install_disk_selector": installDiskSelectorSchema(),
+			"install_extra_kernel_args": {
+				Type:     schema.TypeList,
+				Required: false,
+				Optional: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
 			},
 			"install_image": {
 				Type:     schema.TypeString,
 				Required: false,
 				Optional: true,
-				Default:  "ghcr.io/talos-systems/installer:v0.10.1",
-				ForceNew: true,
+				Default:  "",
 			},
 			"kubernetes_version": {
 				Type:     schema.TypeString,
 				Required: false,
 				Optional: true,
 				Default:  "",
-				ForceNew: true,
 			},
 			"persist_config": {
 				Type:     schema.TypeBool,
 				Required: false,
 				Optional: true,
 				Default:  true,
-				ForceNew: true,
 			},
-			"registry_mirrors": {
-				Type:     schema.TypeMap,
-				Required: false,
-				Optional: true,
-				Elem: &schema.Schema{
-					Type: schema.TypeString,
-				},
-				Default:  map[string]string{},
-				ForceNew: true,
+			"cni":                     cniSchema(),
+			"disk":                    disksSchema(),
+			"extra_manifests":         extraManifestsSchema(),
+			"extra_manifest_headers":  extraManifestHeadersSchema(),
+			"inline_manifest":         inlineManifestSchema(),
+			"external_cloud_provider": externalCloudProviderSchema(),
+			"registries":              registriesSchema(),
+			"system_disk_encryption":  systemDiskEncryptionSchema(),
+			"network":                 networkSchema(),
+			"file":                    filesSchema(),
+			"sysctls":                 sysctlsSchema(),
+			"env":                     envSchema(),
+			"kubelet":                 kubeletSchema(),
+			"kubelet_control_plane":   kubeletSchema(),
+			"kubelet_join":            kubeletSchema(),
+			"apiserver":               apiServerSchema(),
+			"controller_manager":      controllerManagerSchema(),
+			"scheduler":               schedulerSchema(),
+			"proxy":                   proxySchema(),
+			"etcd":                    etcdSchema(),
+			"machine_secrets": {
+				Type:      schema.TypeString,
+				Required:  false,
+				Optional:  true,
+				Default:   "",
+				Sensitive: true,
 			},
 			"talos_version": {
 				Type:     schema.TypeString,
 				Required: false,
 				Optional: true,
 				Default:  "",
-				ForceNew: true,
 			},
 			"config_patch": {
-				Type:     schema.TypeString,
+				Type:         schema.TypeString,
+				Required:     false,
+				Optional:     true,
+				Default:      "",
+				ValidateFunc: validateJSONPatch,
+			},
+			"config_patches": {
+				Type:     schema.TypeList,
 				Required: false,
 				Optional: true,
-				Default:  "",
-				ForceNew: true,
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validateJSONPatch,
+				},
 			},
 			"config_patch_control_plane": {
-				Type:     schema.TypeString,
+				Type:         schema.TypeString,
+				Required:     false,
+				Optional:     true,
+				Default:      "",
+				ValidateFunc: validateJSONPatch,
+			},
+			"config_patches_control_plane": {
+				Type:     schema.TypeList,
 				Required: false,
 				Optional: true,
-				Default:  "",
-				ForceNew: true,
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validateJSONPatch,
+				},
 			},
 			"config_patch_join": {
+				Type:         schema.TypeString,
+				Required:     false,
+				Optional:     true,
+				Default:      "",
+				ValidateFunc: validateJSONPatch,
+			},
+			"config_patches_join": {
+				Type:     schema.TypeList,
+				Required: false,
+				Optional: true,
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validateJSONPatch,
+				},
+			},
+			"config_merge_patch": {
+				Type:         schema.TypeString,
+				Required:     false,
+				Optional:     true,
+				Default:      "",
+				ValidateFunc: validateMergePatch,
+			},
+			"config_merge_patch_control_plane": {
+				Type:         schema.TypeString,
+				Required:     false,
+				Optional:     true,
+				Default:      "",
+				ValidateFunc: validateMergePatch,
+			},
+			"config_merge_patch_join": {
+				Type:         schema.TypeString,
+				Required:     false,
+				Optional:     true,
+				Default:      "",
+				ValidateFunc: validateMergePatch,
+			},
+			"runtime_mode": {
+				Type:         schema.TypeString,
+				Required:     false,
+				Optional:     true,
+				Default:      string(runtimeModeMetal),
+				ValidateFunc: validateRuntimeMode,
+			},
+			"strict_validation": {
+				Type:     schema.TypeBool,
+				Required: false,
+				Optional: true,
+				Default:  false,
+			},
+			"rotate": {
 				Type:     schema.TypeString,
 				Required: false,
 				Optional: true,
@@ -128,56 +250,479 @@ func resourceTalosClusterConfig() *schema.Resource {
 	}
 }
 
-func resourceTalosClusterConfigCreate(d *schema.ResourceData, meta interface{}) error {
-	clusterName := d.Get("cluster_name").(string)
-	endpoint := d.Get("endpoint").(string)
-	additionalSANs, ok := d.Get("additional_sans").([]string)
-	if !ok {
-		additionalSANs = []string{}
-	}
-	dnsDomain := d.Get("dns_domain").(string)
-	installDisk := d.Get("install_disk").(string)
-	installImage := d.Get("install_image").(string)
-	kubernetesVersion := d.Get("kubernetes_version").(string)
-	persistConfig := d.Get("persist_config").(bool)
-	registryMirrors, ok := d.Get("registry_mirrors").(map[string]string)
+func resourceTalosClusterConfigCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	secrets, err := machineSecretsFromResourceData(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	warnings, err := resourceTalosClusterConfigGenerate(d, secrets)
+	if err != nil {
+		return append(warningDiagnostics(warnings), diag.FromErr(err)...)
+	}
+
+	d.SetId(d.Get("cluster_name").(string))
+
+	return warningDiagnostics(warnings)
+}
+
+func resourceTalosClusterConfigUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	secrets, err := machineSecretsFromResourceData(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	// Without explicit machine secrets, keep the cluster identity by
+	// recovering the secrets from the previously generated config, and the
+	// admin certificate from the previous talosconfig.
+	if secrets == nil {
+		controlPlaneUserData, _ := d.GetChange("controlplane_user_data")
+
+		if secrets, err = secretsFromControlPlaneConfig(controlPlaneUserData.(string)); err != nil {
+			return diag.FromErr(err)
+		}
+
+		talosConfig, _ := d.GetChange("talos_config")
+
+		if secrets.Certs.Admin, err = adminCertFromTalosConfig([]byte(talosConfig.(string))); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	warnings, err := resourceTalosClusterConfigGenerate(d, secrets)
+
+	diags := warningDiagnostics(warnings)
+	if err != nil {
+		diags = append(diags, diag.FromErr(err)...)
+	}
+
+	return diags
+}
+
+// resourceTalosClusterConfigImport adopts a cluster generated by `talosctl gen
+// config`. The import ID is either the output directory of that command, the
+// path to its controlplane.yaml or the contents of controlplane.yaml itself.
+func resourceTalosClusterConfigImport(d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	controlPlaneUserData, talosConfig, err := readImportSources(d.Id())
+	if err != nil {
+		return nil, err
+	}
+
+	provider, err := configloader.NewFromBytes(controlPlaneUserData)
+	if err != nil {
+		return nil, fmt.Errorf("error loading controlplane config: %w", err)
+	}
+
+	controlPlaneConfig, ok := provider.(*v1alpha1.Config)
+	if !ok || controlPlaneConfig.MachineConfig == nil || controlPlaneConfig.ClusterConfig == nil {
+		return nil, fmt.Errorf("controlplane config is not a complete v1alpha1 config")
+	}
+
+	if err = setImportedClusterConfig(d, controlPlaneConfig); err != nil {
+		return nil, err
+	}
+
+	if talosConfig != nil {
+		if err = setImportedTalosConfig(d, talosConfig); err != nil {
+			return nil, err
+		}
+	}
+
+	secrets := generate.NewSecretsBundleFromConfig(generate.NewClock(), controlPlaneConfig)
+
+	if talosConfig != nil {
+		if secrets.Certs.Admin, err = adminCertFromTalosConfig(talosConfig); err != nil {
+			return nil, err
+		}
+	}
+
+	// Validation warnings can't be reported on import.
+	if _, err = resourceTalosClusterConfigGenerate(d, secrets); err != nil {
+		return nil, err
+	}
+
+	if talosConfig != nil {
+		if err = d.Set("talos_config", string(talosConfig)); err != nil {
+			return nil, err
+		}
+	}
+
+	d.SetId(controlPlaneConfig.ClusterConfig.ClusterName)
+
+	return []*schema.ResourceData{d}, nil
+}
+
+// readImportSources returns the controlplane.yaml and, when it can be found
+// next to it, the talosconfig for the import ID. The ID is only taken as the
+// config itself when it can't be a path.
+func readImportSources(id string) (controlPlaneUserData, talosConfig []byte, err error) {
+	if strings.Contains(id, "\n") {
+		return []byte(id), nil, nil
+	}
+
+	info, err := os.Stat(id)
+	if err != nil {
+		if os.IsNotExist(err) && looksLikeYAML(id) {
+			return []byte(id), nil, nil
+		}
+
+		return nil, nil, fmt.Errorf("error reading the import source: %w", err)
+	}
+
+	dir, controlPlanePath := id, filepath.Join(id, "controlplane.yaml")
+	if !info.IsDir() {
+		dir, controlPlanePath = filepath.Dir(id), id
+	}
+
+	if controlPlaneUserData, err = ioutil.ReadFile(controlPlanePath); err != nil {
+		return nil, nil, err
+	}
+
+	talosConfig, err = ioutil.ReadFile(filepath.Join(dir, "talosconfig"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+
+	return controlPlaneUserData, talosConfig, nil
+}
+
+// looksLikeYAML reports whether a single line is a YAML mapping rather than
+// a path, like the flow style "{version: v1alpha1, ...}".
+func looksLikeYAML(s string) bool {
+	s = strings.TrimSpace(s)
+
+	return strings.HasPrefix(s, "{") || strings.Contains(s, ": ")
+}
+
+func setImportedClusterConfig(d *schema.ResourceData, c *v1alpha1.Config) error {
+	cluster, machine := c.ClusterConfig, c.MachineConfig
+
+	if cluster.ControlPlane == nil || cluster.ControlPlane.Endpoint == nil {
+		return fmt.Errorf("controlplane config has no cluster endpoint")
+	}
+
+	endpoint := cluster.ControlPlane.Endpoint.String()
+
+	// The endpoint host is always the first API server SAN, followed by the
+	// Talos endpoints, which are also the machine cert SANs. The rest were
+	// passed in as additional SANs.
+	var additionalSANs []string
+
+	if cluster.APIServerConfig != nil {
+		for _, san := range cluster.APIServerConfig.CertSANs {
+			if san != cluster.ControlPlane.Endpoint.Hostname() {
+				additionalSANs = append(additionalSANs, san)
+			}
+		}
+	}
+
+	talosEndpoints := machine.MachineCertSANs
+
+	if len(talosEndpoints) <= len(additionalSANs) && strings.Join(additionalSANs[:len(talosEndpoints)], ",") == strings.Join(talosEndpoints, ",") {
+		additionalSANs = additionalSANs[len(talosEndpoints):]
+	}
+
+	values := map[string]interface{}{
+		"cluster_name":    cluster.ClusterName,
+		"endpoint":        endpoint,
+		"additional_sans": additionalSANs,
+		"talos_endpoints": talosEndpoints,
+		"persist_config":  c.ConfigPersist,
+	}
+
+	if cluster.ClusterNetwork != nil {
+		values["dns_domain"] = cluster.ClusterNetwork.DNSDomain
+
+		// Leave the subnets unset when they are the defaults.
+		podSubnets, serviceSubnets := defaultClusterSubnets(endpoint)
+
+		if strings.Join(cluster.ClusterNetwork.PodSubnet, ",") != strings.Join(podSubnets, ",") {
+			values["pod_subnets"] = cluster.ClusterNetwork.PodSubnet
+		}
+
+		if strings.Join(cluster.ClusterNetwork.ServiceSubnet, ",") != strings.Join(serviceSubnets, ",") {
+			values["service_subnets"] = cluster.ClusterNetwork.ServiceSubnet
+		}
+	}
+
+	if machine.MachineInstall != nil {
+		values["install_disk"] = machine.MachineInstall.InstallDisk
+		values["install_image"] = machine.MachineInstall.InstallImage
+	}
+
+	if machine.MachineKubelet != nil && machine.MachineKubelet.KubeletImage != "" {
+		image := machine.MachineKubelet.KubeletImage
+		values["kubernetes_version"] = strings.TrimPrefix(image[strings.LastIndex(image, ":")+1:], "v")
+	}
+
+	for key, value := range values {
+		if err := d.Set(key, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setImportedTalosConfig picks the Talos API endpoints and nodes from the
+// current context of the imported talosconfig.
+func setImportedTalosConfig(d *schema.ResourceData, talosConfig []byte) error {
+	c, err := clientconfig.FromBytes(talosConfig)
+	if err != nil {
+		return fmt.Errorf("error loading talosconfig: %w", err)
+	}
+
+	talosContext, ok := c.Contexts[c.Context]
 	if !ok {
-		registryMirrors = map[string]string{}
+		return nil
+	}
+
+	endpoints := talosContext.Endpoints
+	if len(endpoints) == 1 && endpoints[0] == defaultTalosEndpoint {
+		endpoints = nil
+	}
+
+	if err = d.Set("talos_endpoints", endpoints); err != nil {
+		return err
+	}
+
+	return d.Set("talos_nodes", talosContext.Nodes)
+}
+
+func resourceTalosClusterConfigCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if newValuesKnown(d, "network") {
+		if err := validateNetworkOptions(expandNetworkOptions(d.Get("network").([]interface{}))); err != nil {
+			return fmt.Errorf("invalid network config: %w", err)
+		}
+	}
+
+	if newValuesKnown(d, "system_disk_encryption") && newValuesKnown(d, "talos_version") {
+		versionContract, err := parseVersionContract(d.Get("talos_version").(string))
+		if err != nil {
+			return err
+		}
+
+		if err = validateSystemDiskEncryption(expandSystemDiskEncryption(d.Get("system_disk_encryption").([]interface{})), versionContract); err != nil {
+			return fmt.Errorf("invalid system disk encryption config: %w", err)
+		}
+	}
+
+	// The contract checks only need the inputs, so they also run when the
+	// configs can't be generated at plan time, like for secrets from a new
+	// talos_machine_secrets.
+	if newValuesKnown(d, "talos_version") && newValuesKnown(d, "install_disk_selector") && newValuesKnown(d, "inline_manifest") && newValuesKnown(d, "external_cloud_provider") {
+		var secrets *generate.SecretsBundle
+
+		if newValuesKnown(d, "machine_secrets") {
+			var err error
+
+			if secrets, err = machineSecretsFromResourceData(d); err != nil {
+				return err
+			}
+		}
+
+		if err := validateConfigInputContract(d, secrets); err != nil {
+			return err
+		}
 	}
-	talosVersion := d.Get("talos_version").(string)
-	configPatch := d.Get("config_patch").(string)
-	configPatchControlPlane := d.Get("config_patch_control_plane").(string)
-	configPatchJoin := d.Get("config_patch_join").(string)
 
-	var options []generate.GenOption
+	if newValuesKnown(d, "cni") {
+		if err := validateCNIConfig(expandCNIConfig(d.Get("cni").([]interface{}))); err != nil {
+			return fmt.Errorf("invalid CNI config: %w", err)
+		}
+	}
 
-	for registryHost, mirrorUrl := range registryMirrors {
-		options = append(options, generate.WithRegistryMirror(registryHost, mirrorUrl))
+	if newValuesKnown(d, "inline_manifest") {
+		if err := expandInlineManifests(d.Get("inline_manifest").([]interface{})).Validate(); err != nil {
+			return fmt.Errorf("invalid inline manifests: %w", err)
+		}
 	}
 
-	if talosVersion != "" {
-		versionContract, err := config.ParseContractFromVersion(talosVersion)
+	if newValuesKnown(d, "file") {
+		files, err := expandFiles(d.Get("file").([]interface{}))
 		if err != nil {
 			return err
 		}
 
-		options = append(options, generate.WithVersionContract(versionContract))
+		if err = validateFiles(files); err != nil {
+			return fmt.Errorf("invalid files config: %w", err)
+		}
+	}
+
+	if newValuesKnown(d, "kubelet") && newValuesKnown(d, "kubelet_control_plane") && newValuesKnown(d, "kubelet_join") {
+		if err := validateClusterKubeletConfigs(
+			expandKubeletConfig(d.Get("kubelet").([]interface{})),
+			expandKubeletConfig(d.Get("kubelet_control_plane").([]interface{})),
+			expandKubeletConfig(d.Get("kubelet_join").([]interface{})),
+		); err != nil {
+			return fmt.Errorf("invalid kubelet config: %w", err)
+		}
+	}
+
+	if newValuesKnown(d, "apiserver") && newValuesKnown(d, "controller_manager") && newValuesKnown(d, "scheduler") && newValuesKnown(d, "proxy") {
+		if err := validateControlPlaneConfig(expandControlPlaneConfig(d)); err != nil {
+			return fmt.Errorf("invalid control plane config: %w", err)
+		}
+	}
+
+	if newValuesKnown(d, "etcd") {
+		if err := validateEtcdConfig(expandEtcdConfig(d.Get("etcd").([]interface{}))); err != nil {
+			return fmt.Errorf("invalid etcd config: %w", err)
+		}
+	}
+
+	if newValuesKnown(d, "endpoint") && newValuesKnown(d, "pod_subnets") && newValuesKnown(d, "service_subnets") {
+		podSubnets, serviceSubnets := expandClusterSubnets(d)
+		if err := validateClusterSubnets(podSubnets, serviceSubnets, parseNodeAddresses(endpointHostname(d.Get("endpoint").(string)))); err != nil {
+			return fmt.Errorf("invalid cluster network config: %w", err)
+		}
 	}
 
-	options = []generate.GenOption{
-		generate.WithInstallDisk(installDisk),
-		generate.WithInstallImage(installImage),
-		generate.WithAdditionalSubjectAltNames(additionalSANs),
-		generate.WithDNSDomain(dnsDomain),
-		generate.WithPersist(persistConfig),
+	if newValuesKnown(d, "external_cloud_provider") {
+		if err := validateExternalCloudProvider(expandExternalCloudProvider(d.Get("external_cloud_provider").([]interface{}))); err != nil {
+			return fmt.Errorf("invalid external cloud provider config: %w", err)
+		}
+	}
+
+	if newValuesKnown(d, "install_disk_selector") {
+		if _, err := expandInstallDiskSelector(d.Get("install_disk_selector").([]interface{})); err != nil {
+			return err
+		}
+	}
+
+	if newValuesKnown(d, "disk") && newValuesKnown(d, "install_disk") && newValuesKnown(d, "install_disk_selector") {
+		installDisk := d.Get("install_disk").(string)
+		if len(d.Get("install_disk_selector").([]interface{})) > 0 {
+			// The selector picks the install disk on the node.
+			installDisk = ""
+		}
+
+		disks, err := expandDisks(d.Get("disk").([]interface{}))
+		if err != nil {
+			return err
+		}
+
+		if err = validateDisks(disks, installDisk); err != nil {
+			return fmt.Errorf("invalid disks config: %w", err)
+		}
+	}
+
+	if argumentValuesKnown(d, resourceTalosClusterConfig().Schema) {
+		warnings, err := validateResourceTalosClusterConfig(d)
+
+		// CustomizeDiff can't return warnings, so they are logged here and
+		// reported as diagnostics on apply.
+		for _, warning := range warnings {
+			log.Printf("[WARN] talos_cluster_config: %s", warning)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.Id() == "" || len(d.GetChangedKeysPrefix("")) == 0 {
+		return nil
+	}
+
+	for _, key := range []string{"bootstrap_user_data", "controlplane_user_data", "join_user_data", "talos_config"} {
+		if err := d.SetNewComputed(key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateResourceTalosClusterConfig generates and validates the configs at
+// plan time, with the secrets apply is going to use, returning the validation
+// warnings. New clusters without machine secrets are validated with throwaway
+// ones.
+func validateResourceTalosClusterConfig(d resourceData) ([]string, error) {
+	var (
+		secrets *generate.SecretsBundle
+		err     error
+	)
+
+	if machineSecrets := d.Get("machine_secrets").(string); machineSecrets != "" {
+		secrets, err = unmarshalSecretsBundle(machineSecrets)
+	} else if controlPlaneUserData := d.Get("controlplane_user_data").(string); controlPlaneUserData != "" {
+		secrets, err = secretsFromControlPlaneConfig(controlPlaneUserData)
 	}
 
-	configBundle, err := mgmt.GenV1Alpha1Config(options, clusterName, endpoint, kubernetesVersion, configPatch, configPatchControlPlane, configPatchJoin)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	configBundle, err := resourceTalosClusterConfigBundle(d, secrets)
+	if err != nil {
+		return nil, err
 	}
 
-	d.SetId(clusterName)
+	return validateConfigBundle(configBundle, runtimeMode(d.Get("runtime_mode").(string)), d.Get("strict_validation").(bool))
+}
+
+func secretsFromControlPlaneConfig(controlPlaneUserData string) (*generate.SecretsBundle, error) {
+	controlPlaneConfig, err := configloader.NewFromBytes([]byte(controlPlaneUserData))
+	if err != nil {
+		return nil, fmt.Errorf("error loading secrets from the controlplane config: %w", err)
+	}
+
+	return generate.NewSecretsBundleFromConfig(generate.NewClock(), controlPlaneConfig), nil
+}
+
+// resourceData is what config generation needs from both schema.ResourceData
+// and schema.ResourceDiff.
+type resourceData interface {
+	Get(key string) interface{}
+}
+
+// expandJSONPatches lists the JSON patches in the order they are applied: all
+// roles, control plane and then join, each starting with the single patch.
+func expandJSONPatches(d resourceData) []jsonPatch {
+	var patches []jsonPatch
+
+	for _, role := range []struct {
+		suffix            string
+		patchControlPlane bool
+		patchJoin         bool
+	}{
+		{"", true, true},
+		{"_control_plane", true, false},
+		{"_join", false, true},
+	} {
+		patches = append(patches, jsonPatch{
+			name:              "config_patch" + role.suffix,
+			patch:             d.Get("config_patch" + role.suffix).(string),
+			patchControlPlane: role.patchControlPlane,
+			patchJoin:         role.patchJoin,
+		})
+
+		for i, patch := range d.Get("config_patches" + role.suffix).([]interface{}) {
+			patches = append(patches, jsonPatch{
+				name:              fmt.Sprintf("config_patches%s[%d]", role.suffix, i),
+				patch:             patch.(string),
+				patchControlPlane: role.patchControlPlane,
+				patchJoin:         role.patchJoin,
+			})
+		}
+	}
+
+	return patches
+}
+
+// resourceTalosClusterConfigGenerate generates and validates the configs,
+// returning the validation warnings.
+func resourceTalosClusterConfigGenerate(d *schema.ResourceData, secrets *generate.SecretsBundle) ([]string, error) {
+	configBundle, err := resourceTalosClusterConfigBundle(d, secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	warnings, err := validateConfigBundle(configBundle, runtimeMode(d.Get("runtime_mode").(string)), d.Get("strict_validation").(bool))
+	if err != nil {
+		return warnings, err
+	}
 
 	encoderOptions := []encoder.Option{
 		encoder.WithComments(encoder.CommentsDisabled),
@@ -185,19 +730,19 @@ func resourceTalosClusterConfigCreate(d *schema.ResourceData, meta interface{})
 
 	bootstrapUserData, err := configBundle.Init().String(encoderOptions...)
 	if err != nil {
-		return err
+		return warnings, err
 	}
 	controlPlaneUserData, err := configBundle.ControlPlane().String(encoderOptions...)
 	if err != nil {
-		return err
+		return warnings, err
 	}
 	joinUserData, err := configBundle.Join().String(encoderOptions...)
 	if err != nil {
-		return err
+		return warnings, err
 	}
 	talosConfigBytes, err := yaml.Marshal(configBundle.TalosConfig())
 	if err != nil {
-		return err
+		return warnings, err
 	}
 
 	d.Set("bootstrap_user_data", bootstrapUserData)
@@ -205,13 +750,46 @@ func resourceTalosClusterConfigCreate(d *schema.ResourceData, meta interface{})
 	d.Set("join_user_data", joinUserData)
 	d.Set("talos_config", string(talosConfigBytes))
 
-	return nil
+	return warnings, nil
+}
+
+func resourceTalosClusterConfigBundle(d resourceData, secrets *generate.SecretsBundle) (*v1alpha1.ConfigBundle, error) {
+	talosNodes := expandStringList(d.Get("talos_nodes").([]interface{}))
+
+	kubeletConfig := expandKubeletConfig(d.Get("kubelet").([]interface{}))
+	kubeletControlPlaneConfig := expandKubeletConfig(d.Get("kubelet_control_plane").([]interface{}))
+	kubeletJoinConfig := expandKubeletConfig(d.Get("kubelet_join").([]interface{}))
+	if err := validateClusterKubeletConfigs(kubeletConfig, kubeletControlPlaneConfig, kubeletJoinConfig); err != nil {
+		return nil, fmt.Errorf("invalid kubelet config: %w", err)
+	}
+
+	input, err := expandConfigInput(d, secrets, talosNodes)
+	if err != nil {
+		return nil, err
+	}
+
+	configOptions := append(input.configOptions,
+		withKubeletConfig(kubeletControlPlaneConfig, true, false),
+		withKubeletConfig(kubeletJoinConfig, false, true),
+		withMergePatch(d.Get("config_merge_patch").(string), true, true),
+		withMergePatch(d.Get("config_merge_patch_control_plane").(string), true, false),
+		withMergePatch(d.Get("config_merge_patch_join").(string), false, true),
+	)
+
+	configBundle, err := genV1Alpha1Config(secrets, input.genOptions, configOptions, input.clusterName, input.endpoint, input.kubernetesVersion, expandJSONPatches(d))
+	if err != nil {
+		return nil, err
+	}
+
+	configBundle.TalosConfig().Contexts[input.clusterName].Nodes = talosNodes
+
+	return configBundle, nil
 }
 
-func resourceTalosClusterConfigRead(d *schema.ResourceData, meta interface{}) error {
+func resourceTalosClusterConfigRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	return nil
 }
 
-func resourceTalosClusterConfigDelete(d *schema.ResourceData, meta interface{}) error {
+func resourceTalosClusterConfigDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	return nil
 }
@@ -0,0 +1,1737 @@
+package talos
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	clientconfig "github.com/talos-systems/talos/pkg/machinery/client/config"
+	"github.com/talos-systems/talos/pkg/machinery/config/configloader"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1/generate"
+	"github.com/talos-systems/talos/pkg/machinery/constants"
+)
+
+func TestResourceTalosClusterConfigGenerate(t *testing.T) {
+	baseConfig := map[string]interface{}{
+		"cluster_name": "test",
+		"endpoint":     "https://10.0.0.10:6443",
+	}
+
+	secrets, err := generate.NewSecretsBundle(generate.NewClock())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	machineSecrets, err := marshalSecretsBundle(secrets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name  string
+		raw   map[string]interface{}
+		check func(t *testing.T, controlPlane, join *v1alpha1.Config)
+	}{
+		{
+			name: "defaults",
+			check: func(t *testing.T, controlPlane, join *v1alpha1.Config) {
+				if controlPlane.ClusterConfig.ClusterName != "test" {
+					t.Errorf("unexpected cluster name %q", controlPlane.ClusterConfig.ClusterName)
+				}
+
+				for _, cfg := range []*v1alpha1.Config{controlPlane, join} {
+					if cfg.ClusterConfig.ControlPlane.Endpoint.String() != "https://10.0.0.10:6443" {
+						t.Errorf("unexpected endpoint %q", cfg.ClusterConfig.ControlPlane.Endpoint)
+					}
+
+					if cfg.MachineConfig.MachineInstall.InstallDisk != "/dev/sda" {
+						t.Errorf("unexpected install disk %q", cfg.MachineConfig.MachineInstall.InstallDisk)
+					}
+
+					if !cfg.ConfigPersist {
+						t.Error("config should be persisted")
+					}
+				}
+
+				if controlPlane.ClusterConfig.ClusterAggregatorCA == nil {
+					t.Error("aggregator CA is missing for the current version contract")
+				}
+
+				if controlPlane.MachineConfig.MachineInstall.InstallImage != "ghcr.io/talos-systems/installer:v0.10.1" {
+					t.Errorf("unexpected install image %q", controlPlane.MachineConfig.MachineInstall.InstallImage)
+				}
+
+				if !strings.HasSuffix(controlPlane.MachineConfig.MachineKubelet.KubeletImage, ":v"+constants.DefaultKubernetesVersion) {
+					t.Errorf("unexpected kubelet image %q", controlPlane.MachineConfig.MachineKubelet.KubeletImage)
+				}
+			},
+		},
+		{
+			name: "additional_sans",
+			raw: map[string]interface{}{
+				"additional_sans": []interface{}{"10.0.0.11", "talos.example.com"},
+			},
+			check: func(t *testing.T, controlPlane, join *v1alpha1.Config) {
+				certSANs := controlPlane.ClusterConfig.APIServerConfig.CertSANs
+
+				for _, san := range []string{"10.0.0.11", "talos.example.com"} {
+					if !stringInSlice(san, certSANs) {
+						t.Errorf("API server cert SANs %v are missing %q", certSANs, san)
+					}
+				}
+			},
+		},
+		{
+			name: "talos_endpoints",
+			raw: map[string]interface{}{
+				"talos_endpoints": []interface{}{"10.0.0.21", "10.0.0.22"},
+			},
+			check: func(t *testing.T, controlPlane, join *v1alpha1.Config) {
+				for _, endpoint := range []string{"10.0.0.21", "10.0.0.22"} {
+					if !stringInSlice(endpoint, controlPlane.MachineConfig.MachineCertSANs) {
+						t.Errorf("machine cert SANs %v are missing %q", controlPlane.MachineConfig.MachineCertSANs, endpoint)
+					}
+				}
+			},
+		},
+		{
+			name: "talos_version",
+			raw: map[string]interface{}{
+				"talos_version": "v0.8.4",
+			},
+			check: func(t *testing.T, controlPlane, join *v1alpha1.Config) {
+				if controlPlane.MachineConfig.MachineInstall.InstallImage != "ghcr.io/talos-systems/installer:v0.8.4" {
+					t.Errorf("unexpected install image %q", controlPlane.MachineConfig.MachineInstall.InstallImage)
+				}
+
+				if !strings.HasSuffix(controlPlane.MachineConfig.MachineKubelet.KubeletImage, ":v1.20.1") {
+					t.Errorf("unexpected kubelet image %q", controlPlane.MachineConfig.MachineKubelet.KubeletImage)
+				}
+
+				if controlPlane.ClusterConfig.ClusterAggregatorCA != nil {
+					t.Error("aggregator CA is not supported by Talos v0.8")
+				}
+
+				if controlPlane.ClusterConfig.ClusterServiceAccount != nil {
+					t.Error("service account key is not supported by Talos v0.8")
+				}
+			},
+		},
+		{
+			name: "talos_version without a patch version",
+			raw: map[string]interface{}{
+				"talos_version": "v0.8",
+			},
+			check: func(t *testing.T, controlPlane, join *v1alpha1.Config) {
+				if controlPlane.MachineConfig.MachineInstall.InstallImage != "ghcr.io/talos-systems/installer:v0.8.4" {
+					t.Errorf("unexpected install image %q", controlPlane.MachineConfig.MachineInstall.InstallImage)
+				}
+
+				if !strings.HasSuffix(controlPlane.MachineConfig.MachineKubelet.KubeletImage, ":v1.20.1") {
+					t.Errorf("unexpected kubelet image %q", controlPlane.MachineConfig.MachineKubelet.KubeletImage)
+				}
+			},
+		},
+		{
+			name: "machine_secrets",
+			raw: map[string]interface{}{
+				"machine_secrets": machineSecrets,
+			},
+			check: func(t *testing.T, controlPlane, join *v1alpha1.Config) {
+				for _, cfg := range []*v1alpha1.Config{controlPlane, join} {
+					if string(cfg.ClusterConfig.ClusterCA.Crt) != string(secrets.Certs.K8s.Crt) {
+						t.Error("Kubernetes CA doesn't come from the machine secrets")
+					}
+
+					if cfg.MachineConfig.MachineToken != secrets.TrustdInfo.Token {
+						t.Errorf("unexpected trustd token %q", cfg.MachineConfig.MachineToken)
+					}
+
+					if cfg.ClusterConfig.BootstrapToken != secrets.Secrets.BootstrapToken {
+						t.Errorf("unexpected bootstrap token %q", cfg.ClusterConfig.BootstrapToken)
+					}
+				}
+
+				if string(controlPlane.MachineConfig.MachineCA.Crt) != string(secrets.Certs.OS.Crt) {
+					t.Error("OS CA doesn't come from the machine secrets")
+				}
+
+				if string(controlPlane.ClusterConfig.EtcdConfig.RootCA.Crt) != string(secrets.Certs.Etcd.Crt) {
+					t.Error("etcd CA doesn't come from the machine secrets")
+				}
+
+				if controlPlane.ClusterConfig.ClusterAESCBCEncryptionSecret != secrets.Secrets.AESCBCEncryptionSecret {
+					t.Error("AES-CBC encryption secret doesn't come from the machine secrets")
+				}
+			},
+		},
+		{
+			name: "registries",
+			raw: map[string]interface{}{
+				"registries": []interface{}{
+					map[string]interface{}{
+						"mirror": []interface{}{
+							map[string]interface{}{
+								"host":      "docker.io",
+								"endpoints": []interface{}{"https://mirror.example.com"},
+							},
+						},
+					},
+				},
+			},
+			check: func(t *testing.T, controlPlane, join *v1alpha1.Config) {
+				for _, cfg := range []*v1alpha1.Config{controlPlane, join} {
+					mirror, ok := cfg.MachineConfig.MachineRegistries.RegistryMirrors["docker.io"]
+					if !ok {
+						t.Fatal("docker.io mirror is missing")
+					}
+
+					if len(mirror.MirrorEndpoints) != 1 || mirror.MirrorEndpoints[0] != "https://mirror.example.com" {
+						t.Errorf("unexpected mirror endpoints %v", mirror.MirrorEndpoints)
+					}
+				}
+			},
+		},
+		{
+			name: "install",
+			raw: map[string]interface{}{
+				"install_disk":              "/dev/nvme0n1",
+				"install_image":             "ghcr.io/talos-systems/installer:v0.10.0",
+				"install_extra_kernel_args": []interface{}{"console=ttyS0"},
+			},
+			check: func(t *testing.T, controlPlane, join *v1alpha1.Config) {
+				for _, cfg := range []*v1alpha1.Config{controlPlane, join} {
+					install := cfg.MachineConfig.MachineInstall
+
+					if install.InstallDisk != "/dev/nvme0n1" {
+						t.Errorf("unexpected install disk %q", install.InstallDisk)
+					}
+
+					if install.InstallImage != "ghcr.io/talos-systems/installer:v0.10.0" {
+						t.Errorf("unexpected install image %q", install.InstallImage)
+					}
+
+					if len(install.InstallExtraKernelArgs) != 1 || install.InstallExtraKernelArgs[0] != "console=ttyS0" {
+						t.Errorf("unexpected extra kernel args %v", install.InstallExtraKernelArgs)
+					}
+				}
+			},
+		},
+		{
+			name: "install_disk_selector",
+			raw: map[string]interface{}{
+				"install_disk_selector": []interface{}{
+					map[string]interface{}{
+						"model": "WDC*",
+					},
+				},
+			},
+			check: func(t *testing.T, controlPlane, join *v1alpha1.Config) {
+				for _, cfg := range []*v1alpha1.Config{controlPlane, join} {
+					install := cfg.MachineConfig.MachineInstall
+
+					if install.InstallDisk != "" {
+						t.Errorf("install disk %q should give way to the selector", install.InstallDisk)
+					}
+
+					if install.InstallDiskSelector == nil || install.InstallDiskSelector.Model != "WDC*" {
+						t.Errorf("unexpected install disk selector %+v", install.InstallDiskSelector)
+					}
+				}
+			},
+		},
+		{
+			name: "cluster",
+			raw: map[string]interface{}{
+				"dns_domain":         "example.local",
+				"kubernetes_version": "v1.20.5",
+				"persist_config":     false,
+			},
+			check: func(t *testing.T, controlPlane, join *v1alpha1.Config) {
+				for _, cfg := range []*v1alpha1.Config{controlPlane, join} {
+					if cfg.ClusterConfig.ClusterNetwork.DNSDomain != "example.local" {
+						t.Errorf("unexpected DNS domain %q", cfg.ClusterConfig.ClusterNetwork.DNSDomain)
+					}
+
+					if !strings.HasSuffix(cfg.MachineConfig.MachineKubelet.KubeletImage, ":v1.20.5") {
+						t.Errorf("unexpected kubelet image %q", cfg.MachineConfig.MachineKubelet.KubeletImage)
+					}
+
+					if cfg.ConfigPersist {
+						t.Error("config should not be persisted")
+					}
+				}
+			},
+		},
+		{
+			name: "manifests",
+			raw: map[string]interface{}{
+				"inline_manifest": []interface{}{
+					map[string]interface{}{
+						"name":     "namespace-ci",
+						"contents": "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: ci\n",
+					},
+				},
+				"extra_manifests": []interface{}{"https://example.com/manifest.yaml"},
+				"extra_manifest_headers": map[string]interface{}{
+					"Token": "1234567",
+				},
+			},
+			check: func(t *testing.T, controlPlane, join *v1alpha1.Config) {
+				cluster := controlPlane.ClusterConfig
+
+				if len(cluster.ClusterInlineManifests) != 1 || cluster.ClusterInlineManifests[0].InlineManifestName != "namespace-ci" {
+					t.Errorf("unexpected inline manifests %+v", cluster.ClusterInlineManifests)
+				}
+
+				if len(cluster.ExtraManifests) != 1 || cluster.ExtraManifests[0] != "https://example.com/manifest.yaml" {
+					t.Errorf("unexpected extra manifests %v", cluster.ExtraManifests)
+				}
+
+				if cluster.ExtraManifestHeaders["Token"] != "1234567" {
+					t.Errorf("unexpected extra manifest headers %v", cluster.ExtraManifestHeaders)
+				}
+			},
+		},
+		{
+			name: "network",
+			raw: map[string]interface{}{
+				"network": []interface{}{
+					map[string]interface{}{
+						"nameservers": []interface{}{"1.1.1.1"},
+					},
+				},
+			},
+			check: func(t *testing.T, controlPlane, join *v1alpha1.Config) {
+				for _, cfg := range []*v1alpha1.Config{controlPlane, join} {
+					nameservers := cfg.MachineConfig.MachineNetwork.NameServers
+					if len(nameservers) != 1 || nameservers[0] != "1.1.1.1" {
+						t.Errorf("unexpected nameservers %v", nameservers)
+					}
+				}
+			},
+		},
+		{
+			name: "config_merge_patch",
+			raw: map[string]interface{}{
+				"network": []interface{}{
+					map[string]interface{}{
+						"interface": []interface{}{
+							map[string]interface{}{
+								"name": "eth0",
+								"cidr": "10.0.0.20/24",
+							},
+						},
+					},
+				},
+				"config_merge_patch": `
+machine:
+  network:
+    interfaces:
+      - interface: eth0
+        mtu: 9000
+      - interface: eth1
+        dhcp: true
+`,
+				"config_merge_patch_join": `
+machine:
+  sysctls:
+    net.ipv4.ip_forward: "1"
+`,
+			},
+			check: func(t *testing.T, controlPlane, join *v1alpha1.Config) {
+				for _, cfg := range []*v1alpha1.Config{controlPlane, join} {
+					interfaces := cfg.MachineConfig.MachineNetwork.NetworkInterfaces
+					if len(interfaces) != 2 {
+						t.Fatalf("unexpected interfaces %+v", interfaces)
+					}
+
+					if interfaces[0].DeviceInterface != "eth0" || interfaces[0].DeviceCIDR != "10.0.0.20/24" || interfaces[0].DeviceMTU != 9000 {
+						t.Errorf("eth0 wasn't merged: %+v", interfaces[0])
+					}
+
+					if interfaces[1].DeviceInterface != "eth1" || !interfaces[1].DeviceDHCP {
+						t.Errorf("eth1 wasn't added: %+v", interfaces[1])
+					}
+				}
+
+				if _, ok := controlPlane.MachineConfig.MachineSysctls["net.ipv4.ip_forward"]; ok {
+					t.Error("join patch was applied to the control plane")
+				}
+
+				if join.MachineConfig.MachineSysctls["net.ipv4.ip_forward"] != "1" {
+					t.Errorf("unexpected join sysctls %v", join.MachineConfig.MachineSysctls)
+				}
+			},
+		},
+		{
+			name: "files",
+			raw: map[string]interface{}{
+				"file": []interface{}{
+					map[string]interface{}{
+						"content":     "[plugins]\n",
+						"path":        "/var/cri/conf.d/custom.toml",
+						"permissions": "0600",
+					},
+					map[string]interface{}{
+						"content": "search example.com\n",
+						"path":    "/etc/resolv.conf",
+						"op":      "append",
+					},
+				},
+				"sysctls": map[string]interface{}{
+					"net.ipv4.ip_forward": "1",
+				},
+				"env": map[string]interface{}{
+					"https_proxy": "http://proxy.example.com:3128",
+				},
+			},
+			check: func(t *testing.T, controlPlane, join *v1alpha1.Config) {
+				for _, cfg := range []*v1alpha1.Config{controlPlane, join} {
+					files := cfg.MachineConfig.MachineFiles
+					if len(files) != 2 {
+						t.Fatalf("unexpected files %+v", files)
+					}
+
+					if files[0].FilePermissions != 0o600 || files[0].FileOp != "create" {
+						t.Errorf("unexpected file %+v", files[0])
+					}
+
+					if files[1].FilePermissions != 0o644 || files[1].FileOp != "append" {
+						t.Errorf("unexpected file %+v", files[1])
+					}
+
+					if cfg.MachineConfig.MachineSysctls["net.ipv4.ip_forward"] != "1" {
+						t.Errorf("unexpected sysctls %v", cfg.MachineConfig.MachineSysctls)
+					}
+
+					if cfg.MachineConfig.MachineEnv["https_proxy"] != "http://proxy.example.com:3128" {
+						t.Errorf("unexpected env %v", cfg.MachineConfig.MachineEnv)
+					}
+				}
+			},
+		},
+		{
+			name: "kubelet",
+			raw: map[string]interface{}{
+				"kubelet": []interface{}{
+					map[string]interface{}{
+						"image": "ghcr.io/talos-systems/kubelet:v1.21.1",
+						"extra_args": map[string]interface{}{
+							"rotate-server-certificates": "true",
+						},
+						"extra_mount": []interface{}{
+							map[string]interface{}{
+								"source":      "/var/lib/csi",
+								"destination": "/var/lib/csi",
+								"options":     []interface{}{"rbind", "rshared", "rw"},
+							},
+						},
+					},
+				},
+			},
+			check: func(t *testing.T, controlPlane, join *v1alpha1.Config) {
+				for _, cfg := range []*v1alpha1.Config{controlPlane, join} {
+					kubelet := cfg.MachineConfig.MachineKubelet
+
+					if kubelet.KubeletImage != "ghcr.io/talos-systems/kubelet:v1.21.1" {
+						t.Errorf("unexpected kubelet image %q", kubelet.KubeletImage)
+					}
+
+					if kubelet.KubeletExtraArgs["rotate-server-certificates"] != "true" {
+						t.Errorf("unexpected kubelet extra args %v", kubelet.KubeletExtraArgs)
+					}
+
+					if len(kubelet.KubeletExtraMounts) != 1 || kubelet.KubeletExtraMounts[0].Type != "bind" {
+						t.Errorf("unexpected kubelet extra mounts %+v", kubelet.KubeletExtraMounts)
+					}
+				}
+			},
+		},
+		{
+			name: "kubelet per role",
+			raw: map[string]interface{}{
+				"kubelet": []interface{}{
+					map[string]interface{}{
+						"extra_args": map[string]interface{}{
+							"rotate-server-certificates": "true",
+						},
+					},
+				},
+				"kubelet_control_plane": []interface{}{
+					map[string]interface{}{
+						"extra_args": map[string]interface{}{
+							"node-labels": "node-role.example.com/control-plane=true",
+						},
+					},
+				},
+				"kubelet_join": []interface{}{
+					map[string]interface{}{
+						"extra_mount": []interface{}{
+							map[string]interface{}{
+								"source":      "/var/lib/csi",
+								"destination": "/var/lib/csi",
+								"options":     []interface{}{"rbind", "rshared", "rw"},
+							},
+						},
+					},
+				},
+			},
+			check: func(t *testing.T, controlPlane, join *v1alpha1.Config) {
+				for _, cfg := range []*v1alpha1.Config{controlPlane, join} {
+					if cfg.MachineConfig.MachineKubelet.KubeletExtraArgs["rotate-server-certificates"] != "true" {
+						t.Errorf("unexpected kubelet extra args %v", cfg.MachineConfig.MachineKubelet.KubeletExtraArgs)
+					}
+				}
+
+				if _, ok := controlPlane.MachineConfig.MachineKubelet.KubeletExtraArgs["node-labels"]; !ok {
+					t.Error("control plane node labels are missing")
+				}
+
+				if len(controlPlane.MachineConfig.MachineKubelet.KubeletExtraMounts) != 0 {
+					t.Errorf("unexpected control plane kubelet extra mounts %+v", controlPlane.MachineConfig.MachineKubelet.KubeletExtraMounts)
+				}
+
+				if _, ok := join.MachineConfig.MachineKubelet.KubeletExtraArgs["node-labels"]; ok {
+					t.Error("control plane node labels are set on the join config")
+				}
+
+				if len(join.MachineConfig.MachineKubelet.KubeletExtraMounts) != 1 {
+					t.Errorf("unexpected join kubelet extra mounts %+v", join.MachineConfig.MachineKubelet.KubeletExtraMounts)
+				}
+			},
+		},
+		{
+			name: "control plane components",
+			raw: map[string]interface{}{
+				"apiserver": []interface{}{
+					map[string]interface{}{
+						"extra_args": map[string]interface{}{
+							"feature-gates": "EphemeralContainers=true",
+						},
+						"cert_sans": []interface{}{"api.example.com"},
+					},
+				},
+				"scheduler": []interface{}{
+					map[string]interface{}{
+						"image": "k8s.gcr.io/kube-scheduler:v1.21.1",
+					},
+				},
+				"proxy": []interface{}{
+					map[string]interface{}{
+						"mode": "ipvs",
+					},
+				},
+			},
+			check: func(t *testing.T, controlPlane, join *v1alpha1.Config) {
+				cluster := controlPlane.ClusterConfig
+
+				if cluster.APIServerConfig.ExtraArgsConfig["feature-gates"] != "EphemeralContainers=true" {
+					t.Errorf("unexpected apiserver extra args %v", cluster.APIServerConfig.ExtraArgsConfig)
+				}
+
+				if !stringInSlice("api.example.com", cluster.APIServerConfig.CertSANs) || !stringInSlice("10.0.0.10", cluster.APIServerConfig.CertSANs) {
+					t.Errorf("unexpected apiserver cert SANs %v", cluster.APIServerConfig.CertSANs)
+				}
+
+				if cluster.SchedulerConfig.ContainerImage != "k8s.gcr.io/kube-scheduler:v1.21.1" {
+					t.Errorf("unexpected scheduler image %q", cluster.SchedulerConfig.ContainerImage)
+				}
+
+				if !strings.Contains(cluster.ControllerManagerConfig.Image(), "kube-controller-manager") {
+					t.Errorf("unexpected controller manager image %q", cluster.ControllerManagerConfig.Image())
+				}
+
+				if cluster.ProxyConfig.Mode() != "ipvs" || !cluster.ProxyConfig.Enabled() {
+					t.Errorf("unexpected proxy config %+v", cluster.ProxyConfig)
+				}
+			},
+		},
+		{
+			name: "etcd",
+			raw: map[string]interface{}{
+				"etcd": []interface{}{
+					map[string]interface{}{
+						"image": "gcr.io/etcd-development/etcd:v3.4.16",
+						"extra_args": map[string]interface{}{
+							"election-timeout": "5000",
+						},
+					},
+				},
+			},
+			check: func(t *testing.T, controlPlane, join *v1alpha1.Config) {
+				etcd := controlPlane.ClusterConfig.EtcdConfig
+
+				if etcd.ContainerImage != "gcr.io/etcd-development/etcd:v3.4.16" {
+					t.Errorf("unexpected etcd image %q", etcd.ContainerImage)
+				}
+
+				if etcd.EtcdExtraArgs["election-timeout"] != "5000" {
+					t.Errorf("unexpected etcd extra args %v", etcd.EtcdExtraArgs)
+				}
+			},
+		},
+		{
+			name: "dual-stack",
+			raw: map[string]interface{}{
+				"pod_subnets":     []interface{}{"10.244.0.0/16", "fd00:10:244::/56"},
+				"service_subnets": []interface{}{"10.96.0.0/12", "fd00:10:96::/112"},
+			},
+			check: func(t *testing.T, controlPlane, join *v1alpha1.Config) {
+				for _, cfg := range []*v1alpha1.Config{controlPlane, join} {
+					if cfg.ClusterConfig.PodCIDR() != "10.244.0.0/16,fd00:10:244::/56" {
+						t.Errorf("unexpected pod subnets %q", cfg.ClusterConfig.PodCIDR())
+					}
+
+					if cfg.ClusterConfig.ServiceCIDR() != "10.96.0.0/12,fd00:10:96::/112" {
+						t.Errorf("unexpected service subnets %q", cfg.ClusterConfig.ServiceCIDR())
+					}
+				}
+			},
+		},
+		{
+			name: "IPv6 endpoint",
+			raw: map[string]interface{}{
+				"endpoint": "https://[fd00::10]:6443",
+			},
+			check: func(t *testing.T, controlPlane, join *v1alpha1.Config) {
+				for _, cfg := range []*v1alpha1.Config{controlPlane, join} {
+					if cfg.ClusterConfig.PodCIDR() != constants.DefaultIPv6PodNet || cfg.ClusterConfig.ServiceCIDR() != constants.DefaultIPv6ServiceNet {
+						t.Errorf("unexpected cluster subnets %q, %q", cfg.ClusterConfig.PodCIDR(), cfg.ClusterConfig.ServiceCIDR())
+					}
+				}
+
+				if sans := controlPlane.ClusterConfig.APIServerConfig.CertSANs; !stringInSlice("fd00::10", sans) {
+					t.Errorf("unexpected apiserver cert SANs %v", sans)
+				}
+			},
+		},
+		{
+			name: "endpoint without a port",
+			raw: map[string]interface{}{
+				"endpoint": "https://api.example.com",
+			},
+			check: func(t *testing.T, controlPlane, join *v1alpha1.Config) {
+				if sans := controlPlane.ClusterConfig.APIServerConfig.CertSANs; len(sans) == 0 || sans[0] != "api.example.com" {
+					t.Errorf("unexpected apiserver cert SANs %v", sans)
+				}
+			},
+		},
+		{
+			name: "external_cloud_provider",
+			raw: map[string]interface{}{
+				"external_cloud_provider": []interface{}{
+					map[string]interface{}{
+						"manifests": []interface{}{"https://example.com/ccm.yaml"},
+					},
+				},
+			},
+			check: func(t *testing.T, controlPlane, join *v1alpha1.Config) {
+				for _, cfg := range []*v1alpha1.Config{controlPlane, join} {
+					ecp := cfg.ClusterConfig.ExternalCloudProvider()
+					if !ecp.Enabled() || len(ecp.ManifestURLs()) != 1 {
+						t.Errorf("unexpected external cloud provider config %+v", ecp)
+					}
+				}
+			},
+		},
+		{
+			name: "system_disk_encryption",
+			raw: map[string]interface{}{
+				"system_disk_encryption": []interface{}{
+					map[string]interface{}{
+						"state": []interface{}{
+							map[string]interface{}{
+								"cipher": "aes-xts-plain64",
+								"key": []interface{}{
+									map[string]interface{}{
+										"slot":              0,
+										"static_passphrase": "secret",
+									},
+									map[string]interface{}{
+										"slot":    1,
+										"node_id": true,
+									},
+								},
+							},
+						},
+						"ephemeral": []interface{}{
+							map[string]interface{}{
+								"key": []interface{}{
+									map[string]interface{}{
+										"slot":    0,
+										"node_id": true,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			check: func(t *testing.T, controlPlane, join *v1alpha1.Config) {
+				for _, cfg := range []*v1alpha1.Config{controlPlane, join} {
+					encryption := cfg.MachineConfig.MachineSystemDiskEncryption
+					if encryption == nil {
+						t.Fatal("system disk encryption is missing")
+					}
+
+					state := encryption.Get(constants.StatePartitionLabel)
+					if state == nil || state.Kind() != "luks2" || state.Cipher() != "aes-xts-plain64" || len(state.Keys()) != 2 {
+						t.Fatalf("unexpected STATE encryption %+v", state)
+					}
+
+					if static := state.Keys()[0].Static(); static == nil || string(static.Key()) != "secret" {
+						t.Errorf("unexpected static key %+v", static)
+					}
+
+					if state.Keys()[1].Slot() != 1 || state.Keys()[1].NodeID() == nil {
+						t.Errorf("unexpected node ID key %+v", state.Keys()[1])
+					}
+
+					ephemeral := encryption.Get(constants.EphemeralPartitionLabel)
+					if ephemeral == nil || len(ephemeral.Keys()) != 1 || ephemeral.Keys()[0].NodeID() == nil {
+						t.Errorf("unexpected EPHEMERAL encryption %+v", ephemeral)
+					}
+				}
+			},
+		},
+		{
+			name: "cni",
+			raw: map[string]interface{}{
+				"cni": []interface{}{
+					map[string]interface{}{
+						"name": "custom",
+						"urls": []interface{}{"https://example.com/cni.yaml"},
+					},
+				},
+			},
+			check: func(t *testing.T, controlPlane, join *v1alpha1.Config) {
+				cni := controlPlane.ClusterConfig.ClusterNetwork.CNI
+				if cni == nil || cni.CNIName != "custom" || len(cni.CNIUrls) != 1 {
+					t.Errorf("unexpected CNI config %+v", cni)
+				}
+			},
+		},
+	} {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			raw := map[string]interface{}{}
+
+			for key, value := range baseConfig {
+				raw[key] = value
+			}
+
+			for key, value := range tt.raw {
+				raw[key] = value
+			}
+
+			d := schema.TestResourceDataRaw(t, resourceTalosClusterConfig().Schema, raw)
+
+			secrets, err := machineSecretsFromResourceData(d)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err = resourceTalosClusterConfigGenerate(d, secrets); err != nil {
+				t.Fatal(err)
+			}
+
+			configs := map[string]*v1alpha1.Config{}
+
+			for _, key := range []string{"bootstrap_user_data", "controlplane_user_data", "join_user_data"} {
+				provider, err := configloader.NewFromBytes([]byte(d.Get(key).(string)))
+				if err != nil {
+					t.Fatalf("error loading %s: %s", key, err)
+				}
+
+				cfg, ok := provider.(*v1alpha1.Config)
+				if !ok {
+					t.Fatalf("%s is not a v1alpha1 config", key)
+				}
+
+				configs[key] = cfg
+			}
+
+			// The bootstrap config only differs from the controlplane one
+			// in the machine type.
+			tt.check(t, configs["bootstrap_user_data"], configs["join_user_data"])
+			tt.check(t, configs["controlplane_user_data"], configs["join_user_data"])
+		})
+	}
+}
+
+func TestResourceTalosClusterConfigTalosConfig(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		raw       map[string]interface{}
+		endpoints []string
+		nodes     []string
+	}{
+		{
+			name:      "defaults",
+			endpoints: []string{"127.0.0.1"},
+		},
+		{
+			name: "endpoints and nodes",
+			raw: map[string]interface{}{
+				"talos_endpoints": []interface{}{"10.0.0.21", "10.0.0.22"},
+				"talos_nodes":     []interface{}{"10.0.0.31"},
+			},
+			endpoints: []string{"10.0.0.21", "10.0.0.22"},
+			nodes:     []string{"10.0.0.31"},
+		},
+	} {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			raw := map[string]interface{}{
+				"cluster_name": "test",
+				"endpoint":     "https://10.0.0.10:6443",
+			}
+
+			for key, value := range tt.raw {
+				raw[key] = value
+			}
+
+			d := schema.TestResourceDataRaw(t, resourceTalosClusterConfig().Schema, raw)
+
+			if _, err := resourceTalosClusterConfigGenerate(d, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			talosConfig, err := clientconfig.FromString(d.Get("talos_config").(string))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			talosContext := talosConfig.Contexts["test"]
+
+			if !reflect.DeepEqual(talosContext.Endpoints, tt.endpoints) {
+				t.Errorf("unexpected endpoints %v", talosContext.Endpoints)
+			}
+
+			if !reflect.DeepEqual(talosContext.Nodes, tt.nodes) {
+				t.Errorf("unexpected nodes %v", talosContext.Nodes)
+			}
+		})
+	}
+}
+
+func TestValidateMergePatch(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		patch string
+		valid bool
+	}{
+		{
+			name:  "empty",
+			patch: "",
+			valid: true,
+		},
+		{
+			name:  "partial config",
+			patch: "machine:\n  install:\n    disk: /dev/nvme0n1\n",
+			valid: true,
+		},
+		{
+			name:  "unknown field",
+			patch: "machine:\n  instal:\n    disk: /dev/nvme0n1\n",
+		},
+		{
+			name:  "wrong type",
+			patch: "machine:\n  install: /dev/nvme0n1\n",
+		},
+	} {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := validateMergePatch(tt.patch, "config_merge_patch")
+
+			if tt.valid && len(errs) > 0 {
+				t.Errorf("unexpected errors %v", errs)
+			}
+
+			if !tt.valid && len(errs) == 0 {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestValidateEndpoint(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		endpoint string
+		errPart  string
+	}{
+		{
+			name:     "IPv4",
+			endpoint: "https://10.0.0.10:6443",
+		},
+		{
+			name:     "bracketed IPv6",
+			endpoint: "https://[fd00::10]:6443",
+		},
+		{
+			name:     "unbracketed IPv6",
+			endpoint: "https://fd00::10:6443",
+			errPart:  "IPv6 addresses should be in brackets",
+		},
+		{
+			name:     "no scheme",
+			endpoint: "10.0.0.10:6443",
+			errPart:  "is not a valid HTTPS URL",
+		},
+	} {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := validateEndpoint(tt.endpoint, "endpoint")
+
+			if tt.errPart == "" {
+				if len(errs) > 0 {
+					t.Fatalf("unexpected errors %v", errs)
+				}
+
+				return
+			}
+
+			if len(errs) != 1 || !strings.Contains(errs[0].Error(), tt.errPart) {
+				t.Fatalf("expected an error containing %q, got %v", tt.errPart, errs)
+			}
+		})
+	}
+}
+
+func TestValidateDisks(t *testing.T) {
+	disk := func(device, size string, partitions ...map[string]interface{}) map[string]interface{} {
+		raw := make([]interface{}, 0, len(partitions))
+
+		for _, partition := range partitions {
+			raw = append(raw, partition)
+		}
+
+		return map[string]interface{}{
+			"device":    device,
+			"size":      size,
+			"partition": raw,
+		}
+	}
+
+	partition := func(size, mountpoint string) map[string]interface{} {
+		return map[string]interface{}{
+			"size":       size,
+			"mountpoint": mountpoint,
+		}
+	}
+
+	for _, tt := range []struct {
+		name    string
+		disks   []interface{}
+		errPart string
+	}{
+		{
+			name: "valid",
+			disks: []interface{}{
+				disk("/dev/sdb", "100GB", partition("60GB", "/var/lib/data"), partition("", "/var/lib/logs")),
+				disk("/dev/sdc", "", partition("", "/var/lib/local-path")),
+			},
+		},
+		{
+			name: "duplicate device",
+			disks: []interface{}{
+				disk("/dev/sdb", "", partition("", "/var/lib/data")),
+				disk("/dev/sdb", "", partition("", "/var/lib/logs")),
+			},
+			errPart: `disk "/dev/sdb": device is listed more than once`,
+		},
+		{
+			name: "overlapping mountpoints",
+			disks: []interface{}{
+				disk("/dev/sdb", "", partition("", "/var/lib/data")),
+				disk("/dev/sdc", "", partition("", "/var/lib/data/cache")),
+			},
+			errPart: `disk "/dev/sdc": mountpoint "/var/lib/data/cache" overlaps with "/var/lib/data"`,
+		},
+		{
+			name: "install disk",
+			disks: []interface{}{
+				disk("/dev/sda", "", partition("", "/var/lib/data")),
+			},
+			errPart: `disk "/dev/sda": device is the install disk`,
+		},
+		{
+			name: "invalid size",
+			disks: []interface{}{
+				disk("/dev/sdb", "", partition("10 parsecs", "/var/lib/data")),
+			},
+			errPart: "unhandled size name: parsecs",
+		},
+		{
+			name: "partitions exceeding the disk size",
+			disks: []interface{}{
+				disk("/dev/sdb", "100GB", partition("60GB", "/var/lib/data"), partition("60GB", "/var/lib/logs")),
+			},
+			errPart: "partitions take up 120 GB, which exceeds the disk size of 100 GB",
+		},
+		{
+			name: "partition after the rest of the disk",
+			disks: []interface{}{
+				disk("/dev/sdb", "", partition("", "/var/lib/data"), partition("10GB", "/var/lib/logs")),
+			},
+			errPart: "partition 0 takes up the rest of the disk, but it's not the last partition",
+		},
+		{
+			name: "mountpoint outside of /var",
+			disks: []interface{}{
+				disk("/dev/sdb", "", partition("", "/mnt/data")),
+			},
+			errPart: `disk "/dev/sdb": mountpoint "/mnt/data" should be under /var`,
+		},
+		{
+			name: "mountpoint on /var",
+			disks: []interface{}{
+				disk("/dev/sdb", "", partition("", "/var")),
+			},
+			errPart: `disk "/dev/sdb": mountpoint "/var" should be under /var`,
+		},
+	} {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			disks, err := expandDisks(tt.disks)
+			if err == nil {
+				err = validateDisks(disks, "/dev/sda")
+			}
+
+			if tt.errPart == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.errPart) {
+				t.Fatalf("expected an error containing %q, got %v", tt.errPart, err)
+			}
+		})
+	}
+}
+
+func TestResourceTalosClusterConfigPatches(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		raw     map[string]interface{}
+		errPart string
+		check   func(t *testing.T, controlPlane, join *v1alpha1.Config)
+	}{
+		{
+			name: "applied in order",
+			raw: map[string]interface{}{
+				"config_patch": `[{"op": "add", "path": "/machine/env", "value": {"A": "config_patch"}}]`,
+				"config_patches": []interface{}{
+					`[{"op": "add", "path": "/machine/env/B", "value": "config_patches[0]"}]`,
+					`[{"op": "replace", "path": "/machine/env/A", "value": "config_patches[1]"}]`,
+				},
+				"config_patches_join": []interface{}{
+					`[{"op": "replace", "path": "/machine/env/B", "value": "config_patches_join[0]"}]`,
+				},
+			},
+			check: func(t *testing.T, controlPlane, join *v1alpha1.Config) {
+				if !reflect.DeepEqual(controlPlane.MachineConfig.MachineEnv, v1alpha1.Env{"A": "config_patches[1]", "B": "config_patches[0]"}) {
+					t.Errorf("unexpected control plane env %v", controlPlane.MachineConfig.MachineEnv)
+				}
+
+				if !reflect.DeepEqual(join.MachineConfig.MachineEnv, v1alpha1.Env{"A": "config_patches[1]", "B": "config_patches_join[0]"}) {
+					t.Errorf("unexpected join env %v", join.MachineConfig.MachineEnv)
+				}
+			},
+		},
+		{
+			name: "failing operation",
+			raw: map[string]interface{}{
+				"config_patches_control_plane": []interface{}{
+					`[{"op": "add", "path": "/machine/env", "value": {"A": "a"}}]`,
+					`[{"op": "add", "path": "/machine/env/C", "value": "c"}, {"op": "remove", "path": "/machine/env/B"}]`,
+				},
+			},
+			errPart: "config_patches_control_plane[1]: operation 1 (remove /machine/env/B)",
+		},
+	} {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			raw := map[string]interface{}{
+				"cluster_name": "test",
+				"endpoint":     "https://10.0.0.10:6443",
+			}
+
+			for key, value := range tt.raw {
+				raw[key] = value
+			}
+
+			d := schema.TestResourceDataRaw(t, resourceTalosClusterConfig().Schema, raw)
+
+			_, err := resourceTalosClusterConfigGenerate(d, nil)
+			if tt.errPart != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errPart) {
+					t.Fatalf("expected an error containing %q, got %v", tt.errPart, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			controlPlane, err := configloader.NewFromBytes([]byte(d.Get("controlplane_user_data").(string)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			join, err := configloader.NewFromBytes([]byte(d.Get("join_user_data").(string)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tt.check(t, controlPlane.(*v1alpha1.Config), join.(*v1alpha1.Config))
+		})
+	}
+}
+
+func TestResourceTalosClusterConfigValidation(t *testing.T) {
+	const customCNIPatch = `cluster:
+  network:
+    cni:
+      name: custom
+`
+
+	secrets, err := generate.NewSecretsBundle(generate.NewClock())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	machineSecrets, err := marshalSecretsBundle(secrets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name     string
+		raw      map[string]interface{}
+		warnings int
+		errPart  string
+	}{
+		{
+			name: "install disk required in metal mode",
+			raw: map[string]interface{}{
+				"install_disk": "",
+			},
+			errPart: "init config is invalid",
+		},
+		{
+			name: "install disk optional in cloud mode",
+			raw: map[string]interface{}{
+				"install_disk": "",
+				"runtime_mode": "cloud",
+			},
+		},
+		{
+			// The cni block fails on a custom CNI without URLs, a patch only
+			// gets the warnings of the init and controlplane configs.
+			name: "warnings",
+			raw: map[string]interface{}{
+				"config_merge_patch": customCNIPatch,
+			},
+			warnings: 2,
+		},
+		{
+			name: "strict",
+			raw: map[string]interface{}{
+				"config_merge_patch": customCNIPatch,
+				"strict_validation":  true,
+			},
+			errPart: "controlplane config is invalid",
+		},
+		{
+			name: "secrets newer than talos_version",
+			raw: map[string]interface{}{
+				"machine_secrets": machineSecrets,
+				"talos_version":   "v0.8",
+			},
+			errPart: "machine secrets with an aggregator CA requires Talos v0.9 or later",
+		},
+		{
+			name: "install_disk_selector on an old talos_version",
+			raw: map[string]interface{}{
+				"install_disk_selector": []interface{}{
+					map[string]interface{}{
+						"model": "WDC*",
+					},
+				},
+				"talos_version": "v0.8",
+			},
+			errPart: "install_disk_selector requires Talos v0.9 or later",
+		},
+		{
+			name: "encryption key slot in use",
+			raw: map[string]interface{}{
+				"system_disk_encryption": []interface{}{
+					map[string]interface{}{
+						"ephemeral": []interface{}{
+							map[string]interface{}{
+								"key": []interface{}{
+									map[string]interface{}{
+										"slot":    0,
+										"node_id": true,
+									},
+									map[string]interface{}{
+										"slot":              0,
+										"static_passphrase": "secret",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			errPart: "EPHEMERAL: encryption key slot 0 is already in use",
+		},
+		{
+			name: "system disk encryption on an old talos_version",
+			raw: map[string]interface{}{
+				"system_disk_encryption": []interface{}{
+					map[string]interface{}{
+						"state": []interface{}{
+							map[string]interface{}{
+								"key": []interface{}{
+									map[string]interface{}{
+										"slot":    0,
+										"node_id": true,
+									},
+								},
+							},
+						},
+					},
+				},
+				"talos_version": "v0.9",
+			},
+			errPart: "system disk encryption requires Talos v0.10 or later",
+		},
+		{
+			name: "file created outside of /var",
+			raw: map[string]interface{}{
+				"file": []interface{}{
+					map[string]interface{}{
+						"content": "test",
+						"path":    "/etc/test",
+					},
+				},
+			},
+			errPart: `file "/etc/test" can only be created under /var`,
+		},
+		{
+			name: "kubelet bind mount without bind option",
+			raw: map[string]interface{}{
+				"kubelet": []interface{}{
+					map[string]interface{}{
+						"extra_mount": []interface{}{
+							map[string]interface{}{
+								"source":      "/var/lib/csi",
+								"destination": "/var/lib/csi",
+								"options":     []interface{}{"rw"},
+							},
+						},
+					},
+				},
+			},
+			errPart: "bind mount options should include bind or rbind",
+		},
+		{
+			name: "kubelet role mount mounted for all roles",
+			raw: map[string]interface{}{
+				"kubelet": []interface{}{
+					map[string]interface{}{
+						"extra_mount": []interface{}{
+							map[string]interface{}{
+								"source":      "/var/lib/csi",
+								"destination": "/var/lib/csi",
+								"options":     []interface{}{"rbind"},
+							},
+						},
+					},
+				},
+				"kubelet_join": []interface{}{
+					map[string]interface{}{
+						"extra_mount": []interface{}{
+							map[string]interface{}{
+								"source":      "/var/lib/csi-join",
+								"destination": "/var/lib/csi/",
+								"options":     []interface{}{"rbind"},
+							},
+						},
+					},
+				},
+			},
+			errPart: `kubelet_join: extra mount "/var/lib/csi/" is already mounted by the kubelet block`,
+		},
+		{
+			name: "managed apiserver flag",
+			raw: map[string]interface{}{
+				"apiserver": []interface{}{
+					map[string]interface{}{
+						"extra_args": map[string]interface{}{
+							"etcd-servers": "https://10.0.0.20:2379",
+						},
+					},
+				},
+			},
+			errPart: "apiserver: --etcd-servers is managed by Talos and can't be overridden",
+		},
+		{
+			name: "managed etcd flag",
+			raw: map[string]interface{}{
+				"etcd": []interface{}{
+					map[string]interface{}{
+						"extra_args": map[string]interface{}{
+							"data-dir": "/var/lib/etcd2",
+						},
+					},
+				},
+			},
+			errPart: "etcd: --data-dir is managed by Talos and can't be overridden",
+		},
+		{
+			name: "overlapping cluster subnets",
+			raw: map[string]interface{}{
+				"pod_subnets":     []interface{}{"10.96.0.0/16"},
+				"service_subnets": []interface{}{"10.96.0.0/12"},
+			},
+			errPart: "pod subnet 10.96.0.0/16 overlaps with service subnet 10.96.0.0/12",
+		},
+		{
+			name: "node address within the pod subnet",
+			raw: map[string]interface{}{
+				"pod_subnets": []interface{}{"10.0.0.0/16"},
+			},
+			errPart: "node address 10.0.0.10 is within the cluster subnet 10.0.0.0/16",
+		},
+		{
+			name: "mixed IP families",
+			raw: map[string]interface{}{
+				"pod_subnets": []interface{}{"fd00:10:244::/56"},
+			},
+			errPart: "pod_subnets and service_subnets should cover the same IP families",
+		},
+		{
+			name: "external cloud provider without manifests",
+			raw: map[string]interface{}{
+				"external_cloud_provider": []interface{}{
+					map[string]interface{}{
+						"enabled": true,
+					},
+				},
+			},
+			errPart: "external cloud provider is enabled, but no manifests are provided",
+		},
+		{
+			name: "disabled external cloud provider on an old talos_version",
+			raw: map[string]interface{}{
+				"external_cloud_provider": []interface{}{
+					map[string]interface{}{
+						"enabled": false,
+					},
+				},
+				"talos_version": "v0.8",
+			},
+		},
+		{
+			name: "external cloud provider on an old talos_version",
+			raw: map[string]interface{}{
+				"external_cloud_provider": []interface{}{
+					map[string]interface{}{
+						"manifests": []interface{}{"https://example.com/ccm.yaml"},
+					},
+				},
+				"talos_version": "v0.8",
+			},
+			errPart: "external_cloud_provider requires Talos v0.9 or later",
+		},
+	} {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			raw := map[string]interface{}{
+				"cluster_name": "test",
+				"endpoint":     "https://10.0.0.10:6443",
+			}
+
+			for key, value := range tt.raw {
+				raw[key] = value
+			}
+
+			r := resourceTalosClusterConfig()
+
+			// A new resource is validated at plan, even though its outputs
+			// are unknown until apply.
+			_, err := r.Diff(context.Background(), nil, terraform.NewResourceConfigRaw(raw), nil)
+			if tt.errPart != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errPart) {
+					t.Fatalf("plan: expected an error containing %q, got %v", tt.errPart, err)
+				}
+			} else if err != nil {
+				t.Fatalf("plan: %s", err)
+			}
+
+			d := schema.TestResourceDataRaw(t, r.Schema, raw)
+
+			secrets, err := machineSecretsFromResourceData(d)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			warnings, err := resourceTalosClusterConfigGenerate(d, secrets)
+			if tt.errPart != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errPart) {
+					t.Fatalf("apply: expected an error containing %q, got %v", tt.errPart, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("apply: %s", err)
+			}
+
+			if len(warnings) != tt.warnings {
+				t.Errorf("apply: unexpected warnings %q", warnings)
+			}
+		})
+	}
+}
+
+func TestResourceTalosClusterConfigPlanContract(t *testing.T) {
+	// unknownValue is hcl2shim.UnknownVariableValue, the value of an
+	// attribute that is only known after apply.
+	const unknownValue = "74D93920-ED26-11E3-AC10-0800200C9A66"
+
+	for _, tt := range []struct {
+		name    string
+		raw     map[string]interface{}
+		errPart string
+	}{
+		{
+			name: "install_disk_selector",
+			raw: map[string]interface{}{
+				"install_disk_selector": []interface{}{
+					map[string]interface{}{
+						"model": "WDC*",
+					},
+				},
+			},
+			errPart: "install_disk_selector requires Talos v0.9 or later",
+		},
+		{
+			name: "inline_manifest",
+			raw: map[string]interface{}{
+				"inline_manifest": []interface{}{
+					map[string]interface{}{
+						"name":     "namespace",
+						"contents": "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: ci\n",
+					},
+				},
+			},
+			errPart: "inline_manifest requires Talos v0.9 or later",
+		},
+		{
+			name: "external_cloud_provider",
+			raw: map[string]interface{}{
+				"external_cloud_provider": []interface{}{
+					map[string]interface{}{
+						"manifests": []interface{}{"https://example.com/ccm.yaml"},
+					},
+				},
+			},
+			errPart: "external_cloud_provider requires Talos v0.9 or later",
+		},
+		{
+			name: "supported",
+			raw:  map[string]interface{}{},
+		},
+	} {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			// The machine secrets of a new talos_machine_secrets are unknown,
+			// so the configs can't be generated at plan time.
+			raw := map[string]interface{}{
+				"cluster_name":    "test",
+				"endpoint":        "https://10.0.0.10:6443",
+				"machine_secrets": unknownValue,
+				"talos_version":   "v0.8",
+			}
+
+			for key, value := range tt.raw {
+				raw[key] = value
+			}
+
+			_, err := resourceTalosClusterConfig().Diff(context.Background(), nil, terraform.NewResourceConfigRaw(raw), nil)
+			if tt.errPart == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.errPart) {
+				t.Fatalf("expected an error containing %q, got %v", tt.errPart, err)
+			}
+		})
+	}
+}
+
+func TestResourceTalosClusterConfigReproducible(t *testing.T) {
+	machineSecrets := schema.TestResourceDataRaw(t, resourceTalosMachineSecrets().Schema, map[string]interface{}{})
+
+	if err := resourceTalosMachineSecretsCreate(machineSecrets, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	generateOutputs := func(raw map[string]interface{}) map[string]string {
+		d := schema.TestResourceDataRaw(t, resourceTalosClusterConfig().Schema, raw)
+
+		secrets, err := machineSecretsFromResourceData(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err = resourceTalosClusterConfigGenerate(d, secrets); err != nil {
+			t.Fatal(err)
+		}
+
+		output := map[string]string{}
+
+		for _, key := range []string{"bootstrap_user_data", "controlplane_user_data", "join_user_data", "talos_config"} {
+			output[key] = d.Get(key).(string)
+		}
+
+		return output
+	}
+
+	raw := map[string]interface{}{
+		"cluster_name":    "test",
+		"endpoint":        "https://10.0.0.10:6443",
+		"machine_secrets": machineSecrets.Get("machine_secrets").(string),
+	}
+
+	first, second := generateOutputs(raw), generateOutputs(raw)
+
+	for key, value := range first {
+		if second[key] != value {
+			t.Errorf("%s differs between runs with the same machine secrets", key)
+		}
+	}
+
+	// Without machine secrets, every run is a new cluster.
+	delete(raw, "machine_secrets")
+
+	first, second = generateOutputs(raw), generateOutputs(raw)
+
+	for key, value := range first {
+		if second[key] == value {
+			t.Errorf("%s is the same between runs without machine secrets", key)
+		}
+	}
+}
+
+func TestResourceTalosClusterConfigUpdate(t *testing.T) {
+	ctx := context.Background()
+	r := resourceTalosClusterConfig()
+
+	raw := map[string]interface{}{
+		"cluster_name": "test",
+		"endpoint":     "https://10.0.0.10:6443",
+	}
+
+	d := schema.TestResourceDataRaw(t, r.Schema, raw)
+
+	if diags := resourceTalosClusterConfigCreate(ctx, d, nil); diags.HasError() {
+		t.Fatal(diags)
+	}
+
+	state := d.State()
+
+	raw["install_image"] = "ghcr.io/talos-systems/installer:v0.10.0"
+
+	diff, err := r.Diff(ctx, state, terraform.NewResourceConfigRaw(raw), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff.RequiresNew() {
+		t.Fatal("changing install_image should update the config in place")
+	}
+
+	newState, diags := r.Apply(ctx, state, diff, nil)
+	if diags.HasError() {
+		t.Fatal(diags)
+	}
+
+	controlPlaneConfigs := make([]*v1alpha1.Config, 0, 2)
+	talosConfigs := make([]*clientconfig.Config, 0, 2)
+
+	for _, attributes := range []map[string]string{state.Attributes, newState.Attributes} {
+		provider, err := configloader.NewFromBytes([]byte(attributes["controlplane_user_data"]))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		controlPlaneConfigs = append(controlPlaneConfigs, provider.(*v1alpha1.Config))
+
+		talosConfig, err := clientconfig.FromString(attributes["talos_config"])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		talosConfigs = append(talosConfigs, talosConfig)
+	}
+
+	before, after := controlPlaneConfigs[0], controlPlaneConfigs[1]
+
+	if after.MachineConfig.MachineInstall.InstallImage != "ghcr.io/talos-systems/installer:v0.10.0" {
+		t.Errorf("unexpected install image %q", after.MachineConfig.MachineInstall.InstallImage)
+	}
+
+	for _, tt := range []struct {
+		name          string
+		before, after interface{}
+	}{
+		{"OS CA", before.MachineConfig.MachineCA, after.MachineConfig.MachineCA},
+		{"Kubernetes CA", before.ClusterConfig.ClusterCA, after.ClusterConfig.ClusterCA},
+		{"etcd CA", before.ClusterConfig.EtcdConfig.RootCA, after.ClusterConfig.EtcdConfig.RootCA},
+		{"aggregator CA", before.ClusterConfig.ClusterAggregatorCA, after.ClusterConfig.ClusterAggregatorCA},
+		{"service account key", before.ClusterConfig.ClusterServiceAccount, after.ClusterConfig.ClusterServiceAccount},
+		{"trustd token", before.MachineConfig.MachineToken, after.MachineConfig.MachineToken},
+		{"bootstrap token", before.ClusterConfig.BootstrapToken, after.ClusterConfig.BootstrapToken},
+		{"AES-CBC encryption secret", before.ClusterConfig.ClusterAESCBCEncryptionSecret, after.ClusterConfig.ClusterAESCBCEncryptionSecret},
+		{"talosconfig admin certificate", talosConfigs[0].Contexts["test"].Crt, talosConfigs[1].Contexts["test"].Crt},
+		{"talosconfig admin key", talosConfigs[0].Contexts["test"].Key, talosConfigs[1].Contexts["test"].Key},
+	} {
+		if !reflect.DeepEqual(tt.before, tt.after) {
+			t.Errorf("%s changed on update", tt.name)
+		}
+	}
+}
+
+func TestResourceTalosClusterConfigImport(t *testing.T) {
+	generated := schema.TestResourceDataRaw(t, resourceTalosClusterConfig().Schema, map[string]interface{}{
+		"cluster_name":    "test",
+		"endpoint":        "https://10.0.0.10:6443",
+		"additional_sans": []interface{}{"talos.example.com"},
+		"talos_endpoints": []interface{}{"10.0.0.21"},
+		"talos_nodes":     []interface{}{"10.0.0.31"},
+		"install_image":   "ghcr.io/talos-systems/installer:v0.10.0",
+	})
+
+	if _, err := resourceTalosClusterConfigGenerate(generated, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	controlPlaneUserData := generated.Get("controlplane_user_data").(string)
+	talosConfig := generated.Get("talos_config").(string)
+
+	dir := t.TempDir()
+
+	for name, content := range map[string]string{
+		"controlplane.yaml": controlPlaneUserData,
+		"talosconfig":       talosConfig,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		name           string
+		id             string
+		hasTalosConfig bool
+		errPart        string
+	}{
+		{
+			name:           "directory",
+			id:             dir,
+			hasTalosConfig: true,
+		},
+		{
+			name:           "controlplane.yaml path",
+			id:             filepath.Join(dir, "controlplane.yaml"),
+			hasTalosConfig: true,
+		},
+		{
+			name: "inline",
+			id:   controlPlaneUserData,
+		},
+		{
+			name:    "missing path",
+			id:      filepath.Join(dir, "missing", "controlplane.yaml"),
+			errPart: "no such file or directory",
+		},
+	} {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			d := resourceTalosClusterConfig().Data(nil)
+			d.SetId(tt.id)
+
+			_, err := resourceTalosClusterConfigImport(d, nil)
+			if tt.errPart != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errPart) {
+					t.Fatalf("expected an error containing %q, got %v", tt.errPart, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if d.Id() != "test" {
+				t.Errorf("unexpected ID %q", d.Id())
+			}
+
+			for _, key := range []string{"cluster_name", "endpoint", "additional_sans", "talos_endpoints", "install_image"} {
+				if !reflect.DeepEqual(d.Get(key), generated.Get(key)) {
+					t.Errorf("unexpected %s %v", key, d.Get(key))
+				}
+			}
+
+			// The config is regenerated from the imported secrets.
+			if d.Get("controlplane_user_data").(string) != controlPlaneUserData {
+				t.Error("controlplane config differs from the imported one")
+			}
+
+			if !tt.hasTalosConfig {
+				return
+			}
+
+			if !reflect.DeepEqual(d.Get("talos_nodes"), generated.Get("talos_nodes")) {
+				t.Errorf("unexpected talos_nodes %v", d.Get("talos_nodes"))
+			}
+
+			if d.Get("talos_config").(string) != talosConfig {
+				t.Error("talosconfig differs from the imported one")
+			}
+		})
+	}
+}
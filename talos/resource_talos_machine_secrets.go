@@ -0,0 +1,138 @@
+package talos
+
+import (
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/talos-systems/talos/pkg/machinery/config"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1/generate"
+)
+
+func resourceTalosMachineSecrets() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceTalosMachineSecretsCreate,
+		Read:   resourceTalosMachineSecretsRead,
+		Delete: resourceTalosMachineSecretsDelete,
+
+		Schema: map[string]*schema.Schema{
+			"talos_version": {
+				Type:     schema.TypeString,
+				Required: false,
+				Optional: true,
+				Default:  "",
+				ForceNew: true,
+			},
+			"machine_secrets": {
+				Type:      schema.TypeString,
+				Computed:  true,
+				Sensitive: true,
+			},
+			"os_ca_certificate": {
+				Type:      schema.TypeString,
+				Computed:  true,
+				Sensitive: true,
+			},
+			"os_ca_key": {
+				Type:      schema.TypeString,
+				Computed:  true,
+				Sensitive: true,
+			},
+			"etcd_ca_certificate": {
+				Type:      schema.TypeString,
+				Computed:  true,
+				Sensitive: true,
+			},
+			"etcd_ca_key": {
+				Type:      schema.TypeString,
+				Computed:  true,
+				Sensitive: true,
+			},
+			"k8s_ca_certificate": {
+				Type:      schema.TypeString,
+				Computed:  true,
+				Sensitive: true,
+			},
+			"k8s_ca_key": {
+				Type:      schema.TypeString,
+				Computed:  true,
+				Sensitive: true,
+			},
+			"k8s_aggregator_ca_certificate": {
+				Type:      schema.TypeString,
+				Computed:  true,
+				Sensitive: true,
+			},
+			"k8s_aggregator_ca_key": {
+				Type:      schema.TypeString,
+				Computed:  true,
+				Sensitive: true,
+			},
+			"k8s_service_account_key": {
+				Type:      schema.TypeString,
+				Computed:  true,
+				Sensitive: true,
+			},
+			"bootstrap_token": {
+				Type:      schema.TypeString,
+				Computed:  true,
+				Sensitive: true,
+			},
+			"aescbc_encryption_secret": {
+				Type:      schema.TypeString,
+				Computed:  true,
+				Sensitive: true,
+			},
+			"trustd_token": {
+				Type:      schema.TypeString,
+				Computed:  true,
+				Sensitive: true,
+			},
+		},
+	}
+}
+
+func resourceTalosMachineSecretsCreate(d *schema.ResourceData, meta interface{}) error {
+	talosVersion := d.Get("talos_version").(string)
+
+	var options []generate.GenOption
+
+	if talosVersion != "" {
+		versionContract, err := config.ParseContractFromVersion(talosVersion)
+		if err != nil {
+			return err
+		}
+
+		options = append(options, generate.WithVersionContract(versionContract))
+	}
+
+	clock := generate.NewClock()
+
+	secrets, err := generate.NewSecretsBundle(clock, options...)
+	if err != nil {
+		return err
+	}
+
+	// Keeping the admin certificate makes talosconfigs generated from the
+	// secrets reproducible.
+	secrets.Certs.Admin, err = generate.NewAdminCertificateAndKey(clock.Now(), secrets.Certs.OS, defaultTalosEndpoint)
+	if err != nil {
+		return err
+	}
+
+	if err = setSecretsBundle(d, secrets); err != nil {
+		return err
+	}
+
+	// The bootstrap token ID is the public half of the token.
+	d.SetId(strings.SplitN(secrets.Secrets.BootstrapToken, ".", 2)[0])
+
+	return nil
+}
+
+func resourceTalosMachineSecretsRead(d *schema.ResourceData, meta interface{}) error {
+	return nil
+}
+
+func resourceTalosMachineSecretsDelete(d *schema.ResourceData, meta interface{}) error {
+	return nil
+}
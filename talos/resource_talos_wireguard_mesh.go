@@ -0,0 +1,267 @@
+package talos
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func resourceTalosWireguardMesh() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceTalosWireguardMeshCreate,
+		ReadContext:   resourceTalosWireguardMeshRead,
+		UpdateContext: resourceTalosWireguardMeshUpdate,
+		DeleteContext: resourceTalosWireguardMeshDelete,
+
+		CustomizeDiff: resourceTalosWireguardMeshCustomizeDiff,
+
+		Schema: map[string]*schema.Schema{
+			"interface": {
+				Type:     schema.TypeString,
+				Required: false,
+				Optional: true,
+				Default:  "wg0",
+			},
+			"listen_port": {
+				Type:     schema.TypeInt,
+				Required: false,
+				Optional: true,
+				Default:  51820,
+			},
+			"persistent_keepalive": {
+				Type:         schema.TypeString,
+				Required:     false,
+				Optional:     true,
+				Default:      "",
+				ValidateFunc: validateDuration,
+			},
+			"node": {
+				Type:     schema.TypeList,
+				Required: true,
+				MinItems: 1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name": {
+							Type:     schema.TypeString,
+							Required: true,
+						},
+						// address is the address of the node on the wireguard
+						// interface.
+						"address": {
+							Type:         schema.TypeString,
+							Required:     true,
+							ValidateFunc: validateCIDR,
+						},
+						// endpoint is the host, or host and port, the other
+						// nodes connect to. Nodes without an endpoint have to
+						// connect first.
+						"endpoint": {
+							Type:     schema.TypeString,
+							Required: false,
+							Optional: true,
+							Default:  "",
+						},
+						"allowed_ips": {
+							Type: schema.TypeList,
+							Elem: &schema.Schema{
+								Type:         schema.TypeString,
+								ValidateFunc: validateCIDR,
+							},
+							Required: false,
+							Optional: true,
+						},
+					},
+				},
+			},
+			"private_keys": {
+				Type:      schema.TypeMap,
+				Computed:  true,
+				Sensitive: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"public_keys": {
+				Type:     schema.TypeMap,
+				Computed: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			// config_merge_patches holds a config_merge_patch per node.
+			"config_merge_patches": {
+				Type:      schema.TypeMap,
+				Computed:  true,
+				Sensitive: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+		},
+	}
+}
+
+func resourceTalosWireguardMeshCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	publicKeys, err := resourceTalosWireguardMeshGenerate(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	keys := make([]string, 0, len(publicKeys))
+
+	for _, key := range publicKeys {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	d.SetId(fmt.Sprintf("%x", sha256.Sum256([]byte(strings.Join(keys, ",")))))
+
+	return nil
+}
+
+func resourceTalosWireguardMeshUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	if _, err := resourceTalosWireguardMeshGenerate(d); err != nil {
+		return diag.FromErr(err)
+	}
+
+	return nil
+}
+
+// resourceTalosWireguardMeshGenerate sets the keys and patches, reusing the
+// private keys planned by CustomizeDiff and those of the nodes already in the
+// state.
+func resourceTalosWireguardMeshGenerate(d *schema.ResourceData) (map[string]string, error) {
+	old, planned := d.GetChange("private_keys")
+
+	existing := map[string]interface{}{}
+
+	for _, keys := range []interface{}{old, planned} {
+		for name, key := range keys.(map[string]interface{}) {
+			existing[name] = key
+		}
+	}
+
+	outputs, err := wireguardMeshOutputs(d, existing)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, value := range outputs {
+		if err := d.Set(key, value); err != nil {
+			return nil, err
+		}
+	}
+
+	return outputs["public_keys"], nil
+}
+
+// wireguardMeshOutputs returns the private_keys, public_keys and
+// config_merge_patches of the mesh, keeping the existing private keys of the
+// nodes and generating them for the new ones.
+func wireguardMeshOutputs(d resourceData, existing map[string]interface{}) (map[string]map[string]string, error) {
+	nodes := expandWireguardNodes(d.Get("node").([]interface{}))
+	if err := validateWireguardNodes(nodes); err != nil {
+		return nil, fmt.Errorf("invalid wireguard mesh: %w", err)
+	}
+
+	privateKeys, err := wireguardPrivateKeys(nodes, existing)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKeys := make(map[string]string, len(privateKeys))
+
+	for name, privateKey := range privateKeys {
+		if publicKeys[name], err = wireguardPublicKey(privateKey); err != nil {
+			return nil, err
+		}
+	}
+
+	keepalive, err := parseDuration(d.Get("persistent_keepalive").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	patches, err := wireguardMergePatches(d.Get("interface").(string), d.Get("listen_port").(int), keepalive, nodes, privateKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]map[string]string{
+		"private_keys":         privateKeys,
+		"public_keys":          publicKeys,
+		"config_merge_patches": patches,
+	}, nil
+}
+
+func resourceTalosWireguardMeshRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	return nil
+}
+
+func resourceTalosWireguardMeshDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	return nil
+}
+
+func resourceTalosWireguardMeshCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	if newValuesKnown(d, "node") {
+		if err := validateWireguardNodes(expandWireguardNodes(d.Get("node").([]interface{}))); err != nil {
+			return fmt.Errorf("invalid wireguard mesh: %w", err)
+		}
+	}
+
+	if d.Id() == "" {
+		return nil
+	}
+
+	inputs := []string{"interface", "listen_port", "persistent_keepalive", "node"}
+
+	changed := false
+
+	for _, key := range inputs {
+		changed = changed || d.HasChange(key)
+	}
+
+	if !changed {
+		return nil
+	}
+
+	outputs := []string{"private_keys", "public_keys", "config_merge_patches"}
+
+	for _, key := range inputs {
+		if newValuesKnown(d, key) {
+			continue
+		}
+
+		for _, output := range outputs {
+			if err := d.SetNewComputed(output); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	// The outputs are planned here, so that the keys of the remaining nodes
+	// stay known in the plan. Maps can't be partially unknown, so the keys of
+	// the new nodes are generated here as well, and apply keeps them.
+	existing, _ := d.GetChange("private_keys")
+
+	values, err := wireguardMeshOutputs(d, existing.(map[string]interface{}))
+	if err != nil {
+		return err
+	}
+
+	for _, output := range outputs {
+		if err := d.SetNew(output, values[output]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,344 @@
+package talos
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/talos-systems/talos/pkg/machinery/config/configloader"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1/generate"
+)
+
+func TestResourceTalosWireguardMeshGenerate(t *testing.T) {
+	secrets, err := generate.NewSecretsBundle(generate.NewClock())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	machineSecrets, err := marshalSecretsBundle(secrets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := schema.TestResourceDataRaw(t, resourceTalosWireguardMesh().Schema, map[string]interface{}{
+		"persistent_keepalive": "25s",
+		"node": []interface{}{
+			map[string]interface{}{
+				"name":     "cp-1",
+				"address":  "10.200.0.1/24",
+				"endpoint": "192.168.1.10",
+			},
+			map[string]interface{}{
+				"name":        "cp-2",
+				"address":     "10.200.0.2/24",
+				"endpoint":    "[fd00::20]:51821",
+				"allowed_ips": []interface{}{"10.100.0.0/16"},
+			},
+			map[string]interface{}{
+				"name":    "worker-1",
+				"address": "10.200.0.3/24",
+			},
+		},
+	})
+
+	publicKeys, err := resourceTalosWireguardMeshGenerate(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	patches := d.Get("config_merge_patches").(map[string]interface{})
+
+	nodePatch := `machine:
+  network:
+    interfaces:
+      - interface: eth0
+        mtu: 9000
+`
+
+	for _, tt := range []struct {
+		node      string
+		address   string
+		endpoints map[string]string
+		allowed   map[string]string
+	}{
+		{
+			node:    "cp-1",
+			address: "10.200.0.1/24",
+			endpoints: map[string]string{
+				"cp-2":     "[fd00::20]:51821",
+				"worker-1": "",
+			},
+			allowed: map[string]string{
+				"cp-2":     "10.200.0.2/32,10.100.0.0/16",
+				"worker-1": "10.200.0.3/32",
+			},
+		},
+		{
+			node:    "worker-1",
+			address: "10.200.0.3/24",
+			endpoints: map[string]string{
+				"cp-1": "192.168.1.10:51820",
+				"cp-2": "[fd00::20]:51821",
+			},
+			allowed: map[string]string{
+				"cp-1": "10.200.0.1/32",
+				"cp-2": "10.200.0.2/32,10.100.0.0/16",
+			},
+		},
+	} {
+		tt := tt
+
+		t.Run(tt.node, func(t *testing.T) {
+			data := schema.TestResourceDataRaw(t, dataSourceTalosMachineConfiguration().Schema, map[string]interface{}{
+				"cluster_name":    "test",
+				"endpoint":        "https://10.0.0.10:6443",
+				"machine_secrets": machineSecrets,
+				"machine_type":    "join",
+				"config_merge_patches": []interface{}{
+					patches[tt.node].(string),
+					nodePatch,
+				},
+			})
+
+			if _, err := dataSourceTalosMachineConfigurationGenerate(data); err != nil {
+				t.Fatal(err)
+			}
+
+			provider, err := configloader.NewFromBytes([]byte(data.Get("machine_configuration").(string)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			devices := map[string]*v1alpha1.Device{}
+
+			for _, device := range provider.(*v1alpha1.Config).MachineConfig.MachineNetwork.NetworkInterfaces {
+				devices[device.DeviceInterface] = device
+			}
+
+			if eth0, ok := devices["eth0"]; !ok || eth0.DeviceMTU != 9000 {
+				t.Errorf("the node patch wasn't applied along the mesh patch: %+v", eth0)
+			}
+
+			device, ok := devices["wg0"]
+			if !ok || device.DeviceCIDR != tt.address {
+				t.Fatalf("unexpected interface %+v", device)
+			}
+
+			wireguard := device.DeviceWireguardConfig
+
+			if wireguard.WireguardListenPort != 51820 || len(wireguard.WireguardPeers) != len(tt.endpoints) {
+				t.Fatalf("unexpected wireguard config %+v", wireguard)
+			}
+
+			for name, endpoint := range tt.endpoints {
+				var peer *v1alpha1.DeviceWireguardPeer
+
+				for _, p := range wireguard.WireguardPeers {
+					if p.WireguardPublicKey == publicKeys[name] {
+						peer = p
+					}
+				}
+
+				if peer == nil {
+					t.Fatalf("%s is missing from the peers", name)
+				}
+
+				if peer.WireguardEndpoint != endpoint {
+					t.Errorf("unexpected endpoint %q for %s", peer.WireguardEndpoint, name)
+				}
+
+				if allowed := strings.Join(peer.WireguardAllowedIPs, ","); allowed != tt.allowed[name] {
+					t.Errorf("unexpected allowed IPs %q for %s", allowed, name)
+				}
+
+				if peer.WireguardPersistentKeepaliveInterval.String() != "25s" {
+					t.Errorf("unexpected keepalive %s for %s", peer.WireguardPersistentKeepaliveInterval, name)
+				}
+			}
+		})
+	}
+}
+
+func TestResourceTalosWireguardMeshUpdate(t *testing.T) {
+	ctx := context.Background()
+	r := resourceTalosWireguardMesh()
+
+	node := func(name, address string) interface{} {
+		return map[string]interface{}{
+			"name":    name,
+			"address": address,
+		}
+	}
+
+	raw := map[string]interface{}{
+		"node": []interface{}{
+			node("a", "10.200.0.1/24"),
+			node("b", "10.200.0.2/24"),
+			node("c", "10.200.0.3/24"),
+		},
+	}
+
+	d := schema.TestResourceDataRaw(t, r.Schema, raw)
+
+	if diags := resourceTalosWireguardMeshCreate(ctx, d, nil); diags.HasError() {
+		t.Fatal(diags)
+	}
+
+	state := d.State()
+
+	raw["node"] = []interface{}{
+		node("a", "10.200.0.1/24"),
+		node("c", "10.200.0.3/24"),
+		node("d", "10.200.0.4/24"),
+	}
+
+	diff, err := r.Diff(ctx, state, terraform.NewResourceConfigRaw(raw), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff.RequiresNew() {
+		t.Fatal("changing the nodes should update the mesh in place")
+	}
+
+	for key, attr := range diff.Attributes {
+		if attr.NewComputed {
+			t.Errorf("%s is unknown in the plan", key)
+		}
+	}
+
+	// The keys of the remaining nodes don't show up in the plan at all.
+	for _, name := range []string{"a", "c"} {
+		for _, output := range []string{"private_keys", "public_keys"} {
+			if attr, ok := diff.Attributes[output+"."+name]; ok {
+				t.Errorf("the plan changes the %s of node %q: %+v", output, name, attr)
+			}
+		}
+	}
+
+	if attr, ok := diff.Attributes["private_keys.b"]; !ok || !attr.NewRemoved {
+		t.Errorf("the plan doesn't remove the private key of the removed node: %+v", attr)
+	}
+
+	newState, diags := r.Apply(ctx, state, diff, nil)
+	if diags.HasError() {
+		t.Fatal(diags)
+	}
+
+	// Apply keeps what was planned, including the key of the added node.
+	for key, attr := range diff.Attributes {
+		if !attr.NewRemoved && newState.Attributes[key] != attr.New {
+			t.Errorf("%s differs from the plan", key)
+		}
+	}
+
+	for _, name := range []string{"a", "c"} {
+		key := "private_keys." + name
+
+		if newState.Attributes[key] == "" || newState.Attributes[key] != state.Attributes[key] {
+			t.Errorf("the private key of node %q changed", name)
+		}
+	}
+
+	if _, ok := newState.Attributes["private_keys.b"]; ok {
+		t.Error("the private key of the removed node was kept")
+	}
+
+	if newState.Attributes["private_keys.d"] == "" {
+		t.Error("no private key was generated for the added node")
+	}
+
+	if newState.Attributes["public_keys.d"] == "" || newState.Attributes["config_merge_patches.d"] == "" {
+		t.Error("the added node is missing from the outputs")
+	}
+}
+
+func TestWireguardPrivateKeys(t *testing.T) {
+	existing, err := wireguardPrivateKeys([]wireguardNode{{name: "a"}, {name: "b"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := map[string]interface{}{}
+
+	for name, key := range existing {
+		state[name] = key
+	}
+
+	keys, err := wireguardPrivateKeys([]wireguardNode{{name: "a"}, {name: "c"}}, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if keys["a"] != existing["a"] {
+		t.Error("the key of an existing node changed")
+	}
+
+	if _, ok := keys["b"]; ok {
+		t.Error("the key of a removed node was kept")
+	}
+
+	if keys["c"] == "" || keys["c"] == existing["a"] || keys["c"] == existing["b"] {
+		t.Errorf("unexpected key for the added node %q", keys["c"])
+	}
+}
+
+func TestValidateWireguardNodes(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		nodes   []wireguardNode
+		errPart string
+	}{
+		{
+			name: "valid",
+			nodes: []wireguardNode{
+				{name: "a", address: "10.200.0.1/24"},
+				{name: "b", address: "fd00:200::2/64", allowedIPs: []string{"10.100.0.0/16"}},
+			},
+		},
+		{
+			name: "duplicate name",
+			nodes: []wireguardNode{
+				{name: "a", address: "10.200.0.1/24"},
+				{name: "a", address: "10.200.0.2/24"},
+			},
+			errPart: `node "a" is listed more than once`,
+		},
+		{
+			name: "duplicate address",
+			nodes: []wireguardNode{
+				{name: "a", address: "10.200.0.1/24"},
+				{name: "b", address: "10.200.0.1/16"},
+			},
+			errPart: `address 10.200.0.1 is already used by node "a"`,
+		},
+		{
+			name: "invalid allowed IP",
+			nodes: []wireguardNode{
+				{name: "a", address: "10.200.0.1/24", allowedIPs: []string{"10.100.0.0"}},
+			},
+			errPart: `allowed IP "10.100.0.0" is not a valid CIDR`,
+		},
+	} {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateWireguardNodes(tt.nodes)
+
+			if tt.errPart == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.errPart) {
+				t.Fatalf("expected an error containing %q, got %v", tt.errPart, err)
+			}
+		})
+	}
+}
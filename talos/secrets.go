@@ -0,0 +1,156 @@
+package talos
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/talos-systems/crypto/x509"
+	clientconfig "github.com/talos-systems/talos/pkg/machinery/client/config"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1/generate"
+	"gopkg.in/yaml.v3"
+)
+
+// secretsBundle is the serialized form of generate.SecretsBundle kept in
+// the machine_secrets attribute. Without an admin certificate a new one is
+// minted from the OS CA every time a talosconfig is generated.
+type secretsBundle struct {
+	Secrets    *generate.Secrets    `yaml:"secrets"`
+	TrustdInfo *generate.TrustdInfo `yaml:"trustdinfo"`
+	Certs      *secretsBundleCerts  `yaml:"certs"`
+}
+
+type secretsBundleCerts struct {
+	Etcd              *x509.PEMEncodedCertificateAndKey `yaml:"etcd"`
+	K8s               *x509.PEMEncodedCertificateAndKey `yaml:"k8s"`
+	K8sAggregator     *x509.PEMEncodedCertificateAndKey `yaml:"k8saggregator,omitempty"`
+	K8sServiceAccount *x509.PEMEncodedKey               `yaml:"k8sserviceaccount,omitempty"`
+	OS                *x509.PEMEncodedCertificateAndKey `yaml:"os"`
+	Admin             *x509.PEMEncodedCertificateAndKey `yaml:"admin,omitempty"`
+}
+
+func marshalSecretsBundle(secrets *generate.SecretsBundle) (string, error) {
+	out, err := yaml.Marshal(&secretsBundle{
+		Secrets:    secrets.Secrets,
+		TrustdInfo: secrets.TrustdInfo,
+		Certs: &secretsBundleCerts{
+			Etcd:              secrets.Certs.Etcd,
+			K8s:               secrets.Certs.K8s,
+			K8sAggregator:     secrets.Certs.K8sAggregator,
+			K8sServiceAccount: secrets.Certs.K8sServiceAccount,
+			OS:                secrets.Certs.OS,
+			Admin:             secrets.Certs.Admin,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return string(out), nil
+}
+
+func unmarshalSecretsBundle(in string) (*generate.SecretsBundle, error) {
+	var bundle secretsBundle
+
+	if err := yaml.Unmarshal([]byte(in), &bundle); err != nil {
+		return nil, fmt.Errorf("error parsing machine secrets: %w", err)
+	}
+
+	if bundle.Secrets == nil || bundle.TrustdInfo == nil || bundle.Certs == nil {
+		return nil, fmt.Errorf("machine secrets are incomplete")
+	}
+
+	if bundle.Certs.Etcd == nil || bundle.Certs.K8s == nil || bundle.Certs.OS == nil {
+		return nil, fmt.Errorf("machine secrets are missing one of the etcd, k8s or os certificate authorities")
+	}
+
+	return &generate.SecretsBundle{
+		Clock:      generate.NewClock(),
+		Secrets:    bundle.Secrets,
+		TrustdInfo: bundle.TrustdInfo,
+		Certs: &generate.Certs{
+			Etcd:              bundle.Certs.Etcd,
+			K8s:               bundle.Certs.K8s,
+			K8sAggregator:     bundle.Certs.K8sAggregator,
+			K8sServiceAccount: bundle.Certs.K8sServiceAccount,
+			OS:                bundle.Certs.OS,
+			Admin:             bundle.Certs.Admin,
+		},
+	}, nil
+}
+
+// adminCertFromTalosConfig returns the admin certificate of the current
+// context of the talosconfig, or nil if it has none.
+func adminCertFromTalosConfig(talosConfig []byte) (*x509.PEMEncodedCertificateAndKey, error) {
+	c, err := clientconfig.FromBytes(talosConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error loading talosconfig: %w", err)
+	}
+
+	talosContext, ok := c.Contexts[c.Context]
+	if !ok || talosContext.Crt == "" || talosContext.Key == "" {
+		return nil, nil
+	}
+
+	crt, err := base64.StdEncoding.DecodeString(talosContext.Crt)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding the talosconfig certificate: %w", err)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(talosContext.Key)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding the talosconfig key: %w", err)
+	}
+
+	return &x509.PEMEncodedCertificateAndKey{Crt: crt, Key: key}, nil
+}
+
+// machineSecretsFromResourceData returns the secrets bundle passed in through
+// the machine_secrets argument, or nil if it wasn't set.
+func machineSecretsFromResourceData(d resourceData) (*generate.SecretsBundle, error) {
+	machineSecrets := d.Get("machine_secrets").(string)
+	if machineSecrets == "" {
+		return nil, nil
+	}
+
+	return unmarshalSecretsBundle(machineSecrets)
+}
+
+func setSecretsBundle(d *schema.ResourceData, secrets *generate.SecretsBundle) error {
+	machineSecrets, err := marshalSecretsBundle(secrets)
+	if err != nil {
+		return err
+	}
+
+	certs := secrets.Certs
+
+	values := map[string]string{
+		"machine_secrets":          machineSecrets,
+		"os_ca_certificate":        string(certs.OS.Crt),
+		"os_ca_key":                string(certs.OS.Key),
+		"etcd_ca_certificate":      string(certs.Etcd.Crt),
+		"etcd_ca_key":              string(certs.Etcd.Key),
+		"k8s_ca_certificate":       string(certs.K8s.Crt),
+		"k8s_ca_key":               string(certs.K8s.Key),
+		"bootstrap_token":          secrets.Secrets.BootstrapToken,
+		"aescbc_encryption_secret": secrets.Secrets.AESCBCEncryptionSecret,
+		"trustd_token":             secrets.TrustdInfo.Token,
+	}
+
+	if certs.K8sAggregator != nil {
+		values["k8s_aggregator_ca_certificate"] = string(certs.K8sAggregator.Crt)
+		values["k8s_aggregator_ca_key"] = string(certs.K8sAggregator.Key)
+	}
+
+	if certs.K8sServiceAccount != nil {
+		values["k8s_service_account_key"] = string(certs.K8sServiceAccount.Key)
+	}
+
+	for key, value := range values {
+		if err := d.Set(key, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,213 @@
+package talos
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/talos-systems/talos/pkg/machinery/config"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1/machine"
+)
+
+// newValuesKnown reports whether the planned value of key, including
+// everything nested under it, is known, so it can be validated at plan time.
+func newValuesKnown(d *schema.ResourceDiff, key string) bool {
+	for _, k := range d.GetChangedKeysPrefix(key) {
+		if !d.NewValueKnown(k) {
+			return false
+		}
+	}
+
+	return d.NewValueKnown(key)
+}
+
+// argumentValuesKnown reports whether the planned values of all the arguments
+// in the schema are known. Computed only attributes are skipped, as they stay
+// unknown until apply.
+func argumentValuesKnown(d *schema.ResourceDiff, s map[string]*schema.Schema) bool {
+	for key, attr := range s {
+		if attr.Computed && !attr.Optional {
+			continue
+		}
+
+		if !newValuesKnown(d, key) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func validateCIDR(v interface{}, k string) ([]string, []error) {
+	value := v.(string)
+	if value == "" {
+		return nil, nil
+	}
+
+	if _, _, err := net.ParseCIDR(value); err != nil {
+		return nil, []error{fmt.Errorf("%q: %q is not a valid CIDR: %w", k, value, err)}
+	}
+
+	return nil, nil
+}
+
+func validateIP(v interface{}, k string) ([]string, []error) {
+	value := v.(string)
+	if value == "" {
+		return nil, nil
+	}
+
+	if net.ParseIP(value) == nil {
+		return nil, []error{fmt.Errorf("%q: %q is not a valid IP address", k, value)}
+	}
+
+	return nil, nil
+}
+
+func validateURL(v interface{}, k string) ([]string, []error) {
+	value := v.(string)
+
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, []error{fmt.Errorf("%q: %q is not a valid HTTP(S) URL", k, value)}
+	}
+
+	return nil, nil
+}
+
+// parseDuration is time.ParseDuration with the empty string meaning zero.
+func parseDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	return time.ParseDuration(value)
+}
+
+func validateDuration(v interface{}, k string) ([]string, []error) {
+	if _, err := parseDuration(v.(string)); err != nil {
+		return nil, []error{fmt.Errorf("%q: %w", k, err)}
+	}
+
+	return nil, nil
+}
+
+func validateMachineType(v interface{}, k string) ([]string, []error) {
+	if _, err := parseMachineType(v.(string)); err != nil {
+		return nil, []error{fmt.Errorf("%q: %w", k, err)}
+	}
+
+	return nil, nil
+}
+
+// runtimeMode implements config.RuntimeMode so that generated configs can be
+// validated without a running machine.
+type runtimeMode string
+
+const (
+	runtimeModeMetal     runtimeMode = "metal"
+	runtimeModeCloud     runtimeMode = "cloud"
+	runtimeModeContainer runtimeMode = "container"
+)
+
+var runtimeModes = []string{string(runtimeModeMetal), string(runtimeModeCloud), string(runtimeModeContainer)}
+
+func (m runtimeMode) String() string {
+	return string(m)
+}
+
+func (m runtimeMode) RequiresInstall() bool {
+	return m == runtimeModeMetal
+}
+
+func validateRuntimeMode(v interface{}, k string) ([]string, []error) {
+	if !stringInSlice(v.(string), runtimeModes) {
+		return nil, []error{fmt.Errorf("%q: runtime mode should be one of %q", k, runtimeModes)}
+	}
+
+	return nil, nil
+}
+
+// validateMachineConfig runs Config.Validate in the given runtime mode,
+// naming the machine type in the warnings and the error.
+func validateMachineConfig(machineType machine.Type, cfg *v1alpha1.Config, mode runtimeMode, strict bool) ([]string, error) {
+	opts := []config.ValidationOption{config.WithLocal()}
+	if strict {
+		opts = append(opts, config.WithStrict())
+	}
+
+	warnings, err := cfg.Validate(mode, opts...)
+
+	for i := range warnings {
+		warnings[i] = fmt.Sprintf("%s config: %s", machineType, warnings[i])
+	}
+
+	if err != nil {
+		return warnings, fmt.Errorf("%s config is invalid: %w", machineType, err)
+	}
+
+	return warnings, nil
+}
+
+// validateConfigBundle validates the init, controlplane and join configs.
+func validateConfigBundle(configBundle *v1alpha1.ConfigBundle, mode runtimeMode, strict bool) ([]string, error) {
+	var (
+		warnings []string
+		result   *multierror.Error
+	)
+
+	for _, c := range []struct {
+		machineType machine.Type
+		cfg         *v1alpha1.Config
+	}{
+		{machine.TypeInit, configBundle.InitCfg},
+		{machine.TypeControlPlane, configBundle.ControlPlaneCfg},
+		{machine.TypeJoin, configBundle.JoinCfg},
+	} {
+		configWarnings, err := validateMachineConfig(c.machineType, c.cfg, mode, strict)
+
+		warnings = append(warnings, configWarnings...)
+		result = multierror.Append(result, err)
+	}
+
+	return warnings, result.ErrorOrNil()
+}
+
+// warningDiagnostics turns validation warnings into Terraform warnings.
+func warningDiagnostics(warnings []string) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	for _, warning := range warnings {
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  warning,
+		})
+	}
+
+	return diags
+}
+
+func stringInSlice(s string, list []string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func expandStringList(list []interface{}) []string {
+	result := make([]string, 0, len(list))
+
+	for _, item := range list {
+		result = append(result, item.(string))
+	}
+
+	return result
+}
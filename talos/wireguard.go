@@ -0,0 +1,201 @@
+package talos
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/talos-systems/talos/pkg/machinery/config/types/v1alpha1"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	"gopkg.in/yaml.v3"
+)
+
+// wireguardNode is a member of the wireguard mesh.
+type wireguardNode struct {
+	name       string
+	address    string
+	endpoint   string
+	allowedIPs []string
+}
+
+func expandWireguardNodes(nodes []interface{}) []wireguardNode {
+	result := make([]wireguardNode, 0, len(nodes))
+
+	for _, raw := range nodes {
+		node := raw.(map[string]interface{})
+
+		result = append(result, wireguardNode{
+			name:       node["name"].(string),
+			address:    node["address"].(string),
+			endpoint:   node["endpoint"].(string),
+			allowedIPs: expandStringList(node["allowed_ips"].([]interface{})),
+		})
+	}
+
+	return result
+}
+
+// validateWireguardNodes checks that node names and addresses are unique and
+// that the addresses and allowed IPs parse.
+func validateWireguardNodes(nodes []wireguardNode) error {
+	var result *multierror.Error
+
+	names := map[string]bool{}
+	addresses := map[string]string{}
+
+	for _, node := range nodes {
+		if names[node.name] {
+			result = multierror.Append(result, fmt.Errorf("node %q is listed more than once", node.name))
+		}
+
+		names[node.name] = true
+
+		ip, _, err := net.ParseCIDR(node.address)
+		if err != nil {
+			result = multierror.Append(result, fmt.Errorf("node %q: address %q is not a valid CIDR: %w", node.name, node.address, err))
+		} else if other, ok := addresses[ip.String()]; ok {
+			result = multierror.Append(result, fmt.Errorf("node %q: address %s is already used by node %q", node.name, ip, other))
+		} else {
+			addresses[ip.String()] = node.name
+		}
+
+		for _, allowedIP := range node.allowedIPs {
+			if _, _, err := net.ParseCIDR(allowedIP); err != nil {
+				result = multierror.Append(result, fmt.Errorf("node %q: allowed IP %q is not a valid CIDR: %w", node.name, allowedIP, err))
+			}
+		}
+	}
+
+	return result.ErrorOrNil()
+}
+
+// wireguardPrivateKeys keeps the existing keys of the nodes and generates new
+// ones for the added nodes, so that changing the mesh only changes the peers.
+func wireguardPrivateKeys(nodes []wireguardNode, existing map[string]interface{}) (map[string]string, error) {
+	result := make(map[string]string, len(nodes))
+
+	for _, node := range nodes {
+		if key, ok := existing[node.name].(string); ok {
+			if _, err := wgtypes.ParseKey(key); err != nil {
+				return nil, fmt.Errorf("error parsing the private key of node %q: %w", node.name, err)
+			}
+
+			result[node.name] = key
+
+			continue
+		}
+
+		key, err := wgtypes.GeneratePrivateKey()
+		if err != nil {
+			return nil, err
+		}
+
+		result[node.name] = key.String()
+	}
+
+	return result, nil
+}
+
+func wireguardPublicKey(privateKey string) (string, error) {
+	key, err := wgtypes.ParseKey(privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	return key.PublicKey().String(), nil
+}
+
+// wireguardPeer is the node as seen by the other nodes: its own address and
+// allowed IPs are routed to it.
+func wireguardPeer(node wireguardNode, publicKey string, listenPort int, keepalive time.Duration) (*v1alpha1.DeviceWireguardPeer, error) {
+	ip, _, err := net.ParseCIDR(node.address)
+	if err != nil {
+		return nil, err
+	}
+
+	hostBits := 32
+	if isIPv6(ip) {
+		hostBits = 128
+	}
+
+	peer := &v1alpha1.DeviceWireguardPeer{
+		WireguardPublicKey:                   publicKey,
+		WireguardPersistentKeepaliveInterval: keepalive,
+		WireguardAllowedIPs:                  append([]string{fmt.Sprintf("%s/%d", ip, hostBits)}, node.allowedIPs...),
+	}
+
+	if node.endpoint != "" {
+		peer.WireguardEndpoint = node.endpoint
+
+		if _, _, err := net.SplitHostPort(node.endpoint); err != nil {
+			peer.WireguardEndpoint = net.JoinHostPort(node.endpoint, fmt.Sprint(listenPort))
+		}
+	}
+
+	return peer, nil
+}
+
+// wireguardMergePatches returns a config merge patch per node adding the
+// wireguard interface with every other node as a peer.
+func wireguardMergePatches(iface string, listenPort int, keepalive time.Duration, nodes []wireguardNode, privateKeys map[string]string) (map[string]string, error) {
+	peers := make(map[string]*v1alpha1.DeviceWireguardPeer, len(nodes))
+
+	for _, node := range nodes {
+		publicKey, err := wireguardPublicKey(privateKeys[node.name])
+		if err != nil {
+			return nil, err
+		}
+
+		if peers[node.name], err = wireguardPeer(node, publicKey, listenPort, keepalive); err != nil {
+			return nil, err
+		}
+	}
+
+	names := make([]string, 0, len(nodes))
+
+	for _, node := range nodes {
+		names = append(names, node.name)
+	}
+
+	// Peers are sorted by name, so that the patches don't depend on the
+	// order of the nodes.
+	sort.Strings(names)
+
+	result := make(map[string]string, len(nodes))
+
+	for _, node := range nodes {
+		wireguardConfig := &v1alpha1.DeviceWireguardConfig{
+			WireguardPrivateKey: privateKeys[node.name],
+			WireguardListenPort: listenPort,
+		}
+
+		for _, name := range names {
+			if name != node.name {
+				wireguardConfig.WireguardPeers = append(wireguardConfig.WireguardPeers, peers[name])
+			}
+		}
+
+		patch, err := yaml.Marshal(map[string]interface{}{
+			"machine": map[string]interface{}{
+				"network": map[string]interface{}{
+					"interfaces": []interface{}{
+						map[string]interface{}{
+							"interface": iface,
+							"cidr":      node.address,
+							"wireguard": wireguardConfig,
+						},
+					},
+				},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		result[node.name] = string(patch)
+	}
+
+	return result, nil
+}